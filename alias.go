@@ -0,0 +1,46 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// collapse replaces, in all the files of the report, the tags in aliases with
+// their canonical name, so that historical names are reported together with
+// the canonical ones.  The positions of an alias are merged with the ones of
+// the canonical tag, when both are used in the same file.  overrides is the
+// category of the tags overridden by the configuration.
+func collapse(report *buildtags.Report, aliases map[string]string, overrides map[string]buildtags.Category) {
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			tags := make([]*buildtags.Tag, 0, len(file.Tags))
+			index := make(map[string]*buildtags.Tag)
+			for _, tag := range file.Tags {
+				if canonical, ok := aliases[tag.Name]; ok {
+					category, ok := overrides[canonical]
+					if !ok {
+						category = buildtags.Categorize(canonical)
+					}
+					tag = &buildtags.Tag{
+						Name:      canonical,
+						Category:  category,
+						Positions: tag.Positions,
+						TestOnly:  tag.TestOnly,
+					}
+				}
+				if prev := index[tag.Name]; prev != nil {
+					prev.Positions = append(prev.Positions, tag.Positions...)
+					prev.TestOnly = prev.TestOnly && tag.TestOnly
+
+					continue
+				}
+				index[tag.Name] = tag
+				tags = append(tags, tag)
+			}
+			file.Tags = tags
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package analyzer defines an Analyzer that reports the build tags specified
+// in the files of a package.
+//
+// The Analyzer can be used with the go vet -vettool flag, with unitchecker
+// and with the gopls analysis framework.
+package analyzer
+
+import (
+	"go/ast"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+const doc = `report the build tags specified in each file
+
+The buildtags analyzer parses the build tags specified in the file name and
+in the //go:build and // +build lines of each Go file in the package, including
+the files ignored in the current build context.
+
+The result of the analyzer is the list of the parsed files, of type
+[]*buildtags.File.  The analyzer exports a *Tags fact for each package.
+
+With the -report flag, a diagnostic is reported for each file specifying at
+least one build tag.`
+
+// Analyzer reports the build tags specified in the files of a package.
+var Analyzer = &analysis.Analyzer{
+	Name:       "buildtags",
+	Doc:        doc,
+	Run:        run,
+	ResultType: reflect.TypeOf([]*buildtags.File(nil)),
+	FactTypes:  []analysis.Fact{new(Tags)},
+}
+
+// report is the value of the -report flag.
+var report bool
+
+func init() {
+	Analyzer.Flags.BoolVar(&report, "report", false, "report the build tags of each file as a diagnostic")
+}
+
+// Tags is the fact recording the build tags specified in a package.
+type Tags struct {
+	Names []string // sorted tag names
+}
+
+// AFact implements the analysis.Fact interface.
+func (*Tags) AFact() {}
+
+func (t *Tags) String() string {
+	return "buildtags(" + strings.Join(t.Names, ", ") + ")"
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	files := make([]*buildtags.File, 0)
+	names := make(map[string]bool)
+
+	for _, f := range pass.Files {
+		path := pass.Fset.File(f.Pos()).Name()
+		file, err := parse(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		for _, tag := range file.Tags {
+			names[tag.Name] = true
+		}
+		if report && len(file.Tags) > 0 {
+			diagnose(pass, f, file)
+		}
+	}
+	for _, path := range pass.IgnoredFiles {
+		if !strings.HasSuffix(path, ".go") {
+			continue
+		}
+		file, err := parse(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		for _, tag := range file.Tags {
+			names[tag.Name] = true
+		}
+	}
+
+	fact := &Tags{Names: make([]string, 0, len(names))}
+	for name := range names {
+		fact.Names = append(fact.Names, name)
+	}
+	sort.Strings(fact.Names)
+	pass.ExportPackageFact(fact)
+
+	return files, nil
+}
+
+// parse parses the build tags in the named Go file.
+func parse(path string) (*buildtags.File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildtags.ParseFile(path, src)
+}
+
+// diagnose reports a diagnostic at the package clause of f, listing the build
+// tags specified in the file.
+func diagnose(pass *analysis.Pass, f *ast.File, file *buildtags.File) {
+	list := make([]string, 0, len(file.Tags))
+	for _, tag := range file.Tags {
+		list = append(list, tag.Name+" ("+string(tag.Category)+")")
+	}
+	pass.Reportf(f.Package, "build tags: %s", strings.Join(list, ", "))
+}
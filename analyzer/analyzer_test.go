@@ -0,0 +1,21 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analyzer
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// TestAnalyzer tests the Analyzer with the -report flag enabled.
+func TestAnalyzer(t *testing.T) {
+	if err := Analyzer.Flags.Set("report", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer Analyzer.Flags.Set("report", "false")
+
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+}
@@ -0,0 +1 @@
+package a // want package:`buildtags\(custom, linux\)`
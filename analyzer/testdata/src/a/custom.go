@@ -0,0 +1,4 @@
+//go:build !custom
+// +build !custom
+
+package a // want "build tags: custom \\(build-tag\\)"
@@ -0,0 +1 @@
+package a // want "build tags: linux \\(GOOS\\)"
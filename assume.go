@@ -0,0 +1,138 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"io"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// residual is the part of the constraints of a file that still varies after
+// assuming the tags specified by the -assume-tags flag.
+type residual struct {
+	File string // file path
+	Expr string // residual constraint expression
+}
+
+// assume restricts the report to what still varies after assuming that the
+// tags in assumed are satisfied.  Files excluded by the assumed tags are
+// removed, and only the tags in the residual constraint of each file are
+// kept.
+func assume(report *buildtags.Report, assumed map[string]bool) {
+	match := func(tag string) bool { return assumed[tag] }
+	for _, pkg := range report.Packages {
+		files := pkg.Files[:0]
+		for _, file := range pkg.Files {
+			var expr constraint.Expr
+			ok := true
+			if x := effective(file); x != nil {
+				expr, ok = buildtags.Residual(x, match)
+			}
+			if expr == nil && !ok {
+				continue
+			}
+			used := make(map[string]bool)
+			exprtags(expr, used)
+			tags := file.Tags[:0]
+			for _, tag := range file.Tags {
+				if used[tag.Name] {
+					tags = append(tags, tag)
+				}
+			}
+			file.Tags = tags
+			files = append(files, file)
+		}
+		pkg.Files = files
+	}
+}
+
+// exprtags adds to set all the build tags in expr.
+func exprtags(expr constraint.Expr, set map[string]bool) {
+	switch x := expr.(type) {
+	case *constraint.AndExpr:
+		exprtags(x.X, set)
+		exprtags(x.Y, set)
+	case *constraint.OrExpr:
+		exprtags(x.X, set)
+		exprtags(x.Y, set)
+	case *constraint.NotExpr:
+		exprtags(x.X, set)
+	case *constraint.TagExpr:
+		set[x.Tag] = true
+	}
+}
+
+// residuals returns the residual constraint of each file in the report whose
+// constraints still vary after assuming that the tags in assumed are
+// satisfied.
+func residuals(report *buildtags.Report, assumed map[string]bool) []*residual {
+	match := func(tag string) bool { return assumed[tag] }
+	list := make([]*residual, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			x := effective(file)
+			if x == nil {
+				continue
+			}
+			if expr, _ := buildtags.Residual(x, match); expr != nil {
+				list = append(list, &residual{File: render(pkg, file.Name), Expr: expr.String()})
+			}
+		}
+	}
+
+	return list
+}
+
+// printresiduals writes to w the residual constraint of each file.
+func printresiduals(w io.Writer, list []*residual) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "residual:")
+	for _, r := range list {
+		fmt.Fprintf(tw, "\t%s\t%s\n", r.File, r.Expr)
+	}
+
+	return tw.Flush()
+}
+
+// unsatisfiable reports whether expr is false for every value of the tags not
+// in values, when the tags in values have the specified value.
+func unsatisfiable(expr constraint.Expr, values map[string]bool) bool {
+	for tag, value := range values {
+		if !value {
+			expr = negate(expr, tag)
+		}
+	}
+	x, ok := buildtags.Residual(expr, func(tag string) bool {
+		_, found := values[tag]
+
+		return found
+	})
+
+	return x == nil && !ok
+}
+
+// negate returns a copy of expr with the named tag negated, so that assuming
+// the tag satisfied in the copy is the same as assuming it not satisfied in
+// expr.
+func negate(expr constraint.Expr, tag string) constraint.Expr {
+	switch x := expr.(type) {
+	case *constraint.AndExpr:
+		return &constraint.AndExpr{X: negate(x.X, tag), Y: negate(x.Y, tag)}
+	case *constraint.OrExpr:
+		return &constraint.OrExpr{X: negate(x.X, tag), Y: negate(x.Y, tag)}
+	case *constraint.NotExpr:
+		return &constraint.NotExpr{X: negate(x.X, tag)}
+	case *constraint.TagExpr:
+		if x.Tag == tag {
+			return &constraint.NotExpr{X: x}
+		}
+	}
+
+	return expr
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package buildtags parses and categorizes the build tags specified in Go
+// packages.
+//
+// Build tags are collected from the Go file names, like in file_linux.go, and
+// from the //go:build and // +build lines in the Go file headers.
+package buildtags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/perillo/go-buildtags/internal/invoke"
+)
+
+// GoCmd is the go command used by Load.
+var GoCmd = "go"
+
+// GoFlags are additional flags passed to the go list command used by Load,
+// like -mod=vendor or -modfile=file.  The GOFLAGS environment variable is
+// also honored, since the go command inherits the environment.
+var GoFlags []string
+
+// GoEnv are additional environment variables for the go list command used by
+// Load, like GOOS=windows, overriding the ones inherited from the process
+// environment.
+var GoEnv []string
+
+// Report is the result of scanning one or more packages.
+type Report struct {
+	Packages []*Package
+}
+
+// Package describes a Go package and the build tags specified in its files.
+type Package struct {
+	Dir        string  // directory containing package sources
+	ImportPath string  // import path of package in dir, if known
+	Name       string  // package name, if known
+	Module     *Module `json:",omitempty"` // info about package's containing module, if any
+	Files      []*File // Go files in the package directory
+
+	// Files excluded by the build context of go list, set by Load.
+	IgnoredGoFiles    []string `json:",omitempty"` // Go source files
+	IgnoredOtherFiles []string `json:",omitempty"` // non-Go source files
+}
+
+// Module describes the module containing a package.
+type Module struct {
+	Path    string // module path
+	Version string `json:",omitempty"` // module version
+	Dir     string // directory holding files for this module, if any
+}
+
+// File describes the build tags specified in a Go file.
+type File struct {
+	Name        string        // file name, relative to the package directory
+	Tags        []*Tag        // build tags, in the order they are first specified
+	Constraints []*Constraint // build constraints in the file header
+	Generated   bool          `json:",omitempty"` // file has a "Code generated ... DO NOT EDIT." header
+	Cgo         bool          `json:",omitempty"` // Go file imports "C"
+	XTest       bool          `json:",omitempty"` // test file of the external _test package
+	BinaryOnly  bool          `json:",omitempty"` // Go file has a //go:binary-only-package comment
+	Misplaced   []int         `json:",omitempty"` // lines of the constraints after the header, ignored by the go command
+	Unseparated []int         `json:",omitempty"` // lines of the // +build constraints not followed by a blank line, ignored by the go command
+}
+
+// Scan parses the build tags in all the Go files in the specified package
+// directories.
+//
+// Scan uses a Scanner with the default options.
+func Scan(dirs []string) (*Report, error) {
+	return ScanContext(context.Background(), dirs)
+}
+
+// ScanContext is like Scan but includes a context.
+//
+// The provided context is checked before reading each package directory and
+// before parsing each file.  If the context is done, ScanContext returns the
+// context error.
+func ScanContext(ctx context.Context, dirs []string) (*Report, error) {
+	return defaultScanner.Scan(ctx, dirs)
+}
+
+// ScanPackages parses the build tags in all the Go files in the directory of
+// each package, setting the package Files field.
+func ScanPackages(packages []*Package) (*Report, error) {
+	return ScanPackagesContext(context.Background(), packages)
+}
+
+// ScanPackagesContext is like ScanPackages but includes a context.
+func ScanPackagesContext(ctx context.Context, packages []*Package) (*Report, error) {
+	return defaultScanner.ScanPackages(ctx, packages)
+}
+
+// ScanFS is like Scan, but the package directories are read from fsys.  The
+// directories must be valid paths, as defined by fs.ValidPath.
+//
+// ScanFS can be used to scan module zip files, embedded files or in memory
+// file systems.
+func ScanFS(fsys fs.FS, dirs []string) (*Report, error) {
+	return ScanFSContext(context.Background(), fsys, dirs)
+}
+
+// ScanFSContext is like ScanFS but includes a context.
+func ScanFSContext(ctx context.Context, fsys fs.FS, dirs []string) (*Report, error) {
+	return defaultScanner.ScanFS(ctx, fsys, dirs)
+}
+
+// FileTags is the result of scanning a single Go file, as reported to the
+// function called by ScanFunc.
+type FileTags struct {
+	Package *Package // the package containing the file
+	File    *File    // the scanned file
+}
+
+// ScanFunc is like ScanContext, but instead of returning a report it calls fn
+// for each Go file in the specified package directories, as soon as the file
+// has been scanned.  The Files field of the reported package is not set.
+//
+// If fn returns an error, ScanFunc stops and returns that error.
+func ScanFunc(ctx context.Context, dirs []string, fn func(FileTags) error) error {
+	return defaultScanner.ScanFunc(ctx, dirs, fn)
+}
+
+// ScanPackagesFunc is like ScanFunc, but for the specified packages.
+func ScanPackagesFunc(ctx context.Context, packages []*Package, fn func(FileTags) error) error {
+	return defaultScanner.ScanPackagesFunc(ctx, packages, fn)
+}
+
+// noGoError is the prefix of the error reported by go list for a package whose
+// Go files are all excluded by the build context.
+const noGoError = "build constraints exclude all Go files"
+
+// Load returns the packages named by the given patterns, as reported by go
+// list.  The Files field of each package is not set.
+//
+// Packages whose Go files are all excluded by the build context of go list
+// are returned too, since their build tags are still of interest.
+func Load(patterns []string) ([]*Package, error) {
+	return LoadContext(context.Background(), patterns)
+}
+
+// LoadContext is like Load but includes a context.
+//
+// The provided context is used to kill the go list process if the context
+// becomes done before the command completes on its own.
+func LoadContext(ctx context.Context, patterns []string) ([]*Package, error) {
+	return LoadDir(ctx, "", patterns)
+}
+
+// LoadDir is like LoadContext, but go list is run in the directory dir, so
+// that the patterns are resolved relative to the module containing dir.  If
+// dir is empty, the current directory is used.
+func LoadDir(ctx context.Context, dir string, patterns []string) ([]*Package, error) {
+	args := []string{"list", "-e", "-json"}
+	args = append(args, GoFlags...)
+	args = append(args, patterns...)
+	cmd := exec.CommandContext(ctx, GoCmd, args...)
+	cmd.Dir = dir
+	if len(GoEnv) > 0 {
+		cmd.Env = append(os.Environ(), GoEnv...)
+	}
+	stdout, err := invoke.Output(cmd)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	// Parse the stream of JSON objects.
+	list := make([]*Package, 0)
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	for dec.More() {
+		var v struct {
+			Package
+			Error *struct {
+				Err string
+			}
+		}
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("load: internal error: %v", err)
+		}
+		if v.Error != nil && !strings.HasPrefix(v.Error.Err, noGoError) {
+			return nil, fmt.Errorf("load: %s", v.Error.Err)
+		}
+		pkg := v.Package
+		list = append(list, &pkg)
+	}
+
+	return list, nil
+}
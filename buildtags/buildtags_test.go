@@ -0,0 +1,1436 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build/constraint"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/fstest"
+)
+
+// TestScan tests the Scan function using the testdata/basic package.
+func TestScan(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	want := map[string]int{
+		"linux":   1,
+		"windows": 1,
+		"amd64":   1,
+		"custom":  2,
+		"cgo":     2,
+		"go1.17":  2,
+	}
+	if got := report.Count(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want Count() = %v, got %v", want, got)
+	}
+}
+
+// TestScanPositions tests the positions of the build tags reported by Scan.
+func TestScanPositions(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var custom *Tag
+	for _, tag := range report.Tags() {
+		if tag.Name == "custom" {
+			custom = tag
+		}
+	}
+	if custom == nil {
+		t.Fatal("custom tag not found")
+	}
+	if custom.Category != BuildTag {
+		t.Errorf("want Category = %s, got %s", BuildTag, custom.Category)
+	}
+
+	path := filepath.Join("testdata", "basic", "custom.go")
+	want := []Position{
+		{File: path, Line: 3, Origin: GoBuild},
+		{File: path, Line: 4, Origin: PlusBuild},
+	}
+	if !reflect.DeepEqual(custom.Positions, want) {
+		t.Errorf("want Positions = %v, got %v", want, custom.Positions)
+	}
+}
+
+// TestFileExpr tests the constraints reported by Scan and the File.Expr
+// method.
+func TestFileExpr(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	for _, file := range report.Packages[0].Files {
+		var want string
+		switch file.Name {
+		case "custom.go":
+			want = "(custom || cgo) && !go1.17"
+			if n := len(file.Constraints); n != 3 {
+				t.Errorf("%s: want 3 constraints, got %d", file.Name, n)
+			}
+		default:
+			if n := len(file.Constraints); n != 0 {
+				t.Errorf("%s: want 0 constraints, got %d", file.Name, n)
+			}
+		}
+
+		var got string
+		if expr := file.Expr(); expr != nil {
+			got = expr.String()
+		}
+		if got != want {
+			t.Errorf("%s: want Expr() = %q, got %q", file.Name, want, got)
+		}
+	}
+}
+
+// TestEvaluate tests the Report.Evaluate method.
+func TestEvaluate(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	tests := []struct {
+		ctx  BuildContext
+		want []string // included files
+	}{
+		{
+			BuildContext{GOOS: "linux", GOARCH: "amd64"},
+			[]string{"doc.go", "file_linux.go"},
+		},
+		{
+			BuildContext{GOOS: "windows", GOARCH: "amd64", CgoEnabled: true},
+			[]string{"custom.go", "doc.go", "file_windows_amd64.go"},
+		},
+		{
+			BuildContext{GOOS: "windows", GOARCH: "arm64", Tags: []string{"custom"}},
+			[]string{"custom.go", "doc.go"},
+		},
+		{
+			BuildContext{GOOS: "darwin", GOARCH: "arm64", Tags: []string{"custom"}, ReleaseTags: []string{"go1.17"}},
+			[]string{"doc.go"},
+		},
+		{
+			BuildContext{GOOS: "android", GOARCH: "arm64"},
+			[]string{"doc.go", "file_linux.go"},
+		},
+	}
+	for _, test := range tests {
+		got := make([]string, 0)
+		for _, m := range report.Evaluate(test.ctx) {
+			if m.Included {
+				got = append(got, m.File.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Evaluate(%+v): want %q, got %q", test.ctx, test.want, got)
+		}
+	}
+}
+
+// TestMatchFileCgo tests that the BuildContext.MatchFile method excludes the
+// Go files importing "C" when cgo is disabled, like the go/build package.
+func TestMatchFileCgo(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		cgo  bool
+		want bool
+	}{
+		{"a.go", "package a\n\nimport \"C\"\n", true, true},
+		{"a.go", "package a\n\nimport \"C\"\n", false, false},
+		{"a.go", "package a\n", false, true},
+		{"a_test.go", "package a\n\nimport \"C\"\n", false, true},
+		{"a.c", "int x;\n", false, true},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		ctx := BuildContext{GOOS: "linux", GOARCH: "amd64", CgoEnabled: test.cgo}
+		if got := ctx.MatchFile(file); got != test.want {
+			t.Errorf("%s with cgo=%t: want %t, got %t", test.name, test.cgo, test.want, got)
+		}
+	}
+}
+
+// TestBinaryOnly tests the detection of the //go:binary-only-package comment.
+func TestBinaryOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want bool
+	}{
+		{"a.go", "//go:binary-only-package\n\npackage a\n", true},
+		{"a.go", "// Package a.\npackage a\n\n//go:binary-only-package\n", false},
+		{"a_test.go", "//go:binary-only-package\n\npackage a\n", false},
+		{"a.s", "//go:binary-only-package\n", false},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		if file.BinaryOnly != test.want {
+			t.Errorf("%s: want BinaryOnly = %t, got %t", test.name, test.want, file.BinaryOnly)
+		}
+	}
+}
+
+// TestMatchTag tests the BuildContext.MatchTag method.
+func TestMatchTag(t *testing.T) {
+	tests := []struct {
+		goos string
+		tag  string
+		want bool
+	}{
+		{"linux", "linux", true},
+		{"linux", "unix", true},
+		{"darwin", "unix", true},
+		{"illumos", "unix", true},
+		{"windows", "unix", false},
+		{"plan9", "unix", false},
+		{"js", "unix", false},
+		{"android", "linux", true},
+		{"android", "android", true},
+		{"ios", "darwin", true},
+		{"illumos", "solaris", true},
+		{"linux", "android", false},
+		{"darwin", "ios", false},
+		{"solaris", "illumos", false},
+	}
+	for _, test := range tests {
+		ctx := BuildContext{GOOS: test.goos, GOARCH: "amd64"}
+		if got := ctx.MatchTag(test.tag); got != test.want {
+			t.Errorf("GOOS=%s: want MatchTag(%q) = %t, got %t", test.goos, test.tag, test.want, got)
+		}
+	}
+}
+
+// TestExplain tests the BuildContext.Explain method.
+func TestExplain(t *testing.T) {
+	file, err := ParseFile("file_linux.go", []byte("//go:build (a || b) && !c\n\npackage p\n"))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	ctx := BuildContext{GOOS: "darwin", GOARCH: "amd64", Tags: []string{"c"}}
+	e := ctx.Explain(file)
+	want := []string{
+		"file name requires GOOS=linux: not satisfied",
+		`line 1: go:build constraint "(a || b) && !c": not satisfied`,
+		"\ta is false",
+		"\tb is false",
+		"\tc is true",
+	}
+	if e.Included {
+		t.Error("want Included = false")
+	}
+	if !reflect.DeepEqual(e.Reasons, want) {
+		t.Errorf("want Reasons = %q, got %q", want, e.Reasons)
+	}
+}
+
+// TestResidual tests the Residual function.
+func TestResidual(t *testing.T) {
+	tests := []struct {
+		expr    string
+		assumed []string
+		want    string // residual expression, or the value if constant
+	}{
+		{"prod && linux", []string{"prod"}, "linux"},
+		{"prod && cgo", []string{"prod", "cgo"}, "true"},
+		{"!prod", []string{"prod"}, "false"},
+		{"prod || linux", []string{"prod"}, "true"},
+		{"!prod || linux", []string{"prod"}, "linux"},
+		{"!prod && linux", []string{"prod"}, "false"},
+		{"(a || b) && !(c && prod)", []string{"prod"}, "(a || b) && !c"},
+		{"a && b", []string{"c"}, "a && b"},
+	}
+	for _, test := range tests {
+		expr, err := constraint.Parse("//go:build " + test.expr)
+		if err != nil {
+			t.Fatalf("constraint.Parse(%q): %v", test.expr, err)
+		}
+		assumed := make(map[string]bool)
+		for _, tag := range test.assumed {
+			assumed[tag] = true
+		}
+		x, ok := Residual(expr, func(tag string) bool { return assumed[tag] })
+		got := strconv.FormatBool(ok)
+		if x != nil {
+			got = x.String()
+		}
+		if got != test.want {
+			t.Errorf("Residual(%q, %q): want %s, got %s", test.expr, test.assumed, test.want, got)
+		}
+	}
+}
+
+// TestMatrix tests the Report.Matrix method.
+func TestMatrix(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	matrix, excluded := report.Matrix(BuildContext{})
+	if n := len(excluded); n != 0 {
+		t.Errorf("want 0 excluded files, got %d", n)
+	}
+
+	// Check that every file is included by at least one context.
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			found := false
+			for _, ctx := range matrix {
+				found = found || ctx.MatchFile(file)
+			}
+			if !found {
+				t.Errorf("%s: not included by any context", file.Name)
+			}
+		}
+	}
+	if n := len(matrix); n != 2 {
+		t.Errorf("want 2 contexts, got %d: %+v", n, matrix)
+	}
+}
+
+// TestMatrixCgo tests that the Report.Matrix method enables cgo for the Go
+// files importing "C" without a cgo build tag.
+func TestMatrixCgo(t *testing.T) {
+	src := []struct {
+		name string
+		src  string
+	}{
+		{"c.go", "package p\n\nimport \"C\"\n"},
+		{"nocgo.go", "//go:build !cgo\n\npackage p\n"},
+		{"x_linux.go", "package p\n"},
+	}
+	pkg := &Package{Dir: "p"}
+	for _, s := range src {
+		file, err := ParseFile(s.name, []byte(s.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", s.name, err)
+		}
+		pkg.Files = append(pkg.Files, file)
+	}
+	report := &Report{Packages: []*Package{pkg}}
+
+	matrix, excluded := report.Matrix(BuildContext{})
+	for _, m := range excluded {
+		t.Errorf("%s: not included by any context", m.File.Name)
+	}
+	if n := len(matrix); n != 2 {
+		t.Errorf("want 2 contexts, got %d: %+v", n, matrix)
+	}
+}
+
+// TestMatrixBase tests that the Report.Matrix method selects the port of the
+// base context for the files without constraints.
+func TestMatrixBase(t *testing.T) {
+	file, err := ParseFile("a.go", []byte("package p\n"))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	pkg := &Package{Dir: "p", Files: []*File{file}}
+	report := &Report{Packages: []*Package{pkg}}
+
+	for _, port := range []Port{{"linux", "amd64"}, {"darwin", "arm64"}, {"windows", "386"}} {
+		matrix, _ := report.Matrix(BuildContext{GOOS: port.GOOS, GOARCH: port.GOARCH})
+		if len(matrix) != 1 {
+			t.Errorf("%s: want 1 context, got %d", port, len(matrix))
+
+			continue
+		}
+		if got := (Port{matrix[0].GOOS, matrix[0].GOARCH}); got != port {
+			t.Errorf("want port %s, got %s", port, got)
+		}
+	}
+}
+
+// TestMatrixTags tests that the Report.Matrix method sets the build tags
+// outside the build-tag category, like purego, netgo and gofuzz.
+func TestMatrixTags(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		tag  string // tag set to include the file
+	}{
+		{"a_purego.go", "//go:build purego\n\npackage p\n", "purego"},
+		{"b_netgo.go", "//go:build netgo\n\npackage p\n", "netgo"},
+		{"c_fuzz.go", "//go:build gofuzz\n\npackage p\n", "gofuzz"},
+		{"d_race.go", "//go:build race\n\npackage p\n", "race"},
+		{"e_unix.go", "//go:build unix\n\npackage p\n", ""},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		pkg := &Package{Dir: "p", Files: []*File{file}}
+		report := &Report{Packages: []*Package{pkg}}
+
+		matrix, excluded := report.Matrix(BuildContext{})
+		if len(excluded) > 0 || len(matrix) != 1 {
+			t.Errorf("%s: want 1 context, got %d and %d excluded files", test.name, len(matrix), len(excluded))
+
+			continue
+		}
+		var want []string
+		if test.tag != "" {
+			want = []string{test.tag}
+		}
+		if got := matrix[0].Tags; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want tags %q, got %q", test.name, want, got)
+		}
+	}
+}
+
+// TestMatrixImpliedOS tests that the Report.Matrix method only selects a GOOS
+// implying another one, like android, for the files requiring it.
+func TestMatrixImpliedOS(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string // GOOS values of the contexts
+	}{
+		{[]string{"a_linux.go"}, []string{"linux"}},
+		{[]string{"a_darwin.go"}, []string{"darwin"}},
+		{[]string{"a_solaris.go"}, []string{"solaris"}},
+		{[]string{"a_linux.go", "a_android.go"}, []string{"android"}},
+	}
+	for _, test := range tests {
+		pkg := &Package{Dir: "p"}
+		for _, name := range test.names {
+			file, err := ParseFile(name, []byte("package p\n"))
+			if err != nil {
+				t.Fatalf("ParseFile(%q): %v", name, err)
+			}
+			pkg.Files = append(pkg.Files, file)
+		}
+		report := &Report{Packages: []*Package{pkg}}
+
+		matrix, _ := report.Matrix(BuildContext{})
+		got := make([]string, 0, len(matrix))
+		for _, ctx := range matrix {
+			got = append(got, ctx.GOOS)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: want GOOS %q, got %q", test.names, test.want, got)
+		}
+	}
+}
+
+// TestStats tests the Report.Stats method using the testdata/basic package.
+func TestStats(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	stats := report.Stats(1)
+	if stats.Files != 4 || stats.Constrained != 3 || stats.Unconstrained != 1 {
+		t.Errorf("want 4 files and 3 constrained, got %d files and %d constrained",
+			stats.Files, stats.Constrained)
+	}
+	want := map[int]int{6: 1}
+	if !reflect.DeepEqual(stats.TagsPerPackage, want) {
+		t.Errorf("want TagsPerPackage = %v, got %v", want, stats.TagsPerPackage)
+	}
+	if n := len(stats.CustomTags); n != 1 || stats.CustomTags[0].Name != "custom" {
+		t.Errorf("want custom tags = [custom], got %d tags", n)
+	}
+	if n := len(stats.Deepest); n != 1 {
+		t.Fatalf("want 1 deepest expression, got %d", n)
+	}
+	if d := stats.Deepest[0]; d.Depth != 2 || d.Constraint.Line != 3 {
+		t.Errorf("want depth 2 at line 3, got depth %d at line %d", d.Depth, d.Constraint.Line)
+	}
+}
+
+// TestDepth tests the depth function.
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		expr string
+		want int
+	}{
+		{"a", 0},
+		{"!a", 1},
+		{"a && b && c", 1},
+		{"a || b || c", 1},
+		{"(a || b) && c", 2},
+		{"!(a && b)", 2},
+		{"(a && (b || !c)) || d", 4},
+	}
+	for _, test := range tests {
+		expr, err := constraint.Parse("//go:build " + test.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		if got := depth(expr); got != test.want {
+			t.Errorf("depth(%q): want %d, got %d", test.expr, test.want, got)
+		}
+	}
+}
+
+// TestReportJSON tests that a report can be decoded from its JSON encoding.
+func TestReportJSON(t *testing.T) {
+	report, err := Scan([]string{"testdata/basic"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	got := new(Report)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("decoded report differs from the original")
+	}
+}
+
+// TestScanContext tests that ScanContext returns the context error when the
+// context is canceled.
+func TestScanContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ScanContext(ctx, []string{"testdata/basic"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want err = %v, got %v", context.Canceled, err)
+	}
+}
+
+// TestScanFunc tests that ScanFunc reports each file and stops when the
+// callback returns an error.
+func TestScanFunc(t *testing.T) {
+	names := make([]string, 0)
+	err := ScanFunc(context.Background(), []string{"testdata/basic"}, func(ft FileTags) error {
+		names = append(names, ft.File.Name)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanFunc: %v", err)
+	}
+	want := []string{"custom.go", "doc.go", "file_linux.go", "file_windows_amd64.go"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("want files = %q, got %q", want, names)
+	}
+
+	errStop := errors.New("stop")
+	n := 0
+	err = ScanFunc(context.Background(), []string{"testdata/basic"}, func(ft FileTags) error {
+		n++
+
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("want err = %v, got %v", errStop, err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 call, got %d", n)
+	}
+}
+
+// TestScanFS tests the ScanFS function using an in memory file system.
+func TestScanFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file_linux.go": {Data: []byte("package a\n")},
+		"a/file.go":       {Data: []byte("//go:build custom\n\npackage a\n")},
+		"a/README":        {Data: []byte("not a Go file\n")},
+	}
+	report, err := ScanFS(fsys, []string{"a"})
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+
+	want := map[string]int{
+		"linux":  1,
+		"custom": 1,
+	}
+	if got := report.Count(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want Count() = %v, got %v", want, got)
+	}
+
+	if _, err := ScanFS(fsys, []string{"/a"}); err == nil {
+		t.Error("expected err != nil for an invalid path")
+	}
+}
+
+// TestScanError tests the errors returned by ScanFS.
+func TestScanError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/expr.go":   {Data: []byte("//go:build linux &&\n\npackage a\n")},
+		"b/syntax.go": {Data: []byte("// comment\n\npackage\n")},
+	}
+	tests := []struct {
+		dir  string
+		file string
+		line int
+	}{
+		{"a", "a/expr.go", 1},
+		{"b", "b/syntax.go", 3},
+		{"c", "c", 0},
+	}
+	for _, test := range tests {
+		_, err := ScanFS(fsys, []string{test.dir})
+
+		var serr *ScanError
+		if !errors.As(err, &serr) {
+			t.Errorf("%s: expected err as %T, got %T", test.dir, serr, err)
+
+			continue
+		}
+		if serr.File != test.file {
+			t.Errorf("%s: want File = %s, got %s", test.dir, test.file, serr.File)
+		}
+		if serr.Line != test.line {
+			t.Errorf("%s: want Line = %d, got %d", test.dir, test.line, serr.Line)
+		}
+	}
+
+	_, err := ScanFS(fsys, []string{"c"})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want err = %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+// TestScannerOptions tests the options of a Scanner.
+func TestScannerOptions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file_linux.go":       {Data: []byte("//go:build custom\n\npackage a\n")},
+		"a/file_darwin_test.go": {Data: []byte("package a\n")},
+		"a/_file_windows.go":    {Data: []byte("package a\n")},
+	}
+	tests := []struct {
+		opts []Option
+		want map[string]int
+	}{
+		{
+			nil,
+			map[string]int{"linux": 1, "custom": 1, "darwin": 1, "windows": 1},
+		},
+		{
+			[]Option{WithTestFiles(false)},
+			map[string]int{"linux": 1, "custom": 1, "windows": 1},
+		},
+		{
+			[]Option{WithOnlyTestFiles()},
+			map[string]int{"darwin": 1},
+		},
+		{
+			[]Option{WithFilePattern("file_*_test.go")},
+			map[string]int{"darwin": 1},
+		},
+		{
+			[]Option{WithIgnoredFiles(false)},
+			map[string]int{"linux": 1, "custom": 1, "darwin": 1},
+		},
+		{
+			[]Option{WithFileFilter(func(path string) bool { return path != "a/file_linux.go" })},
+			map[string]int{"darwin": 1, "windows": 1},
+		},
+		{
+			[]Option{WithCategories(BuildTag), WithTestFiles(false)},
+			map[string]int{"custom": 1},
+		},
+		{
+			[]Option{WithTagCategories(map[string]Category{"custom": SpecialTag}), WithCategories(SpecialTag)},
+			map[string]int{"custom": 1},
+		},
+	}
+	for i, test := range tests {
+		s := NewScanner(test.opts...)
+		report, err := s.ScanFS(context.Background(), fsys, []string{"a"})
+		if err != nil {
+			t.Fatalf("#%d: ScanFS: %v", i, err)
+		}
+		if got := report.Count(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%d: want Count() = %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// TestTagTestOnly tests that the tags used only in test files are reported.
+func TestTagTestOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a.go":          {Data: []byte("//go:build linux\n\npackage a\n")},
+		"a/a_test.go":     {Data: []byte("//go:build linux && integration\n\npackage a\n")},
+		"a/x_ext_test.go": {Data: []byte("//go:build e2e\n\npackage a_test\n")},
+	}
+	report, err := ScanFS(fsys, []string{"a"})
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+
+	want := map[string]bool{"linux": false, "integration": true, "e2e": true}
+	for _, tag := range report.Tags() {
+		if tag.TestOnly != want[tag.Name] {
+			t.Errorf("%s: want TestOnly = %v, got %v", tag.Name, want[tag.Name], tag.TestOnly)
+		}
+	}
+}
+
+// TestGeneratedFiles tests the detection of generated files.
+func TestGeneratedFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a.go":     {Data: []byte("//go:build linux\n\npackage a\n")},
+		"a/z_gen.go": {Data: []byte("// Code generated by stringer; DO NOT EDIT.\n\n//go:build gen\n\npackage a\n")},
+	}
+	for _, workers := range []int{1, 4} {
+		report, err := NewScanner(WithConcurrency(workers)).ScanFS(context.Background(), fsys, []string{"a"})
+		if err != nil {
+			t.Fatalf("ScanFS: %v", err)
+		}
+		if files := report.Packages[0].Files; len(files) != 2 || files[0].Generated || !files[1].Generated {
+			t.Errorf("want only z_gen.go to be generated")
+		}
+
+		s := NewScanner(WithGeneratedFiles(false), WithConcurrency(workers))
+		report, err = s.ScanFS(context.Background(), fsys, []string{"a"})
+		if err != nil {
+			t.Fatalf("ScanFS: %v", err)
+		}
+		if n := len(report.Packages[0].Files); n != 1 {
+			t.Errorf("workers %d: want 1 file, got %d", workers, n)
+		}
+	}
+}
+
+// TestSymlinks tests the WithSymlinks option.
+func TestSymlinks(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "shared_linux.go")
+	if err := os.WriteFile(src, []byte("package p\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "p")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(src, filepath.Join(dir, "shared_linux.go")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink("missing.go", filepath.Join(dir, "broken.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		s := NewScanner(WithSymlinks(follow))
+		report, err := s.Scan(context.Background(), []string{dir})
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		want := 0
+		if follow {
+			want = 1
+		}
+		if n := len(report.Packages[0].Files); n != want {
+			t.Errorf("follow %v: want %d files, got %d", follow, want, n)
+		}
+	}
+}
+
+// TestOverlay tests that the scanner applies the overlay replacements.
+func TestOverlay(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "p")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "a.go"):       "//go:build old\n\npackage p\n",
+		filepath.Join(dir, "b_linux.go"): "package p\n",
+		filepath.Join(root, "a.go"):      "//go:build new\n\npackage p\n",
+		filepath.Join(root, "c.go"):      "//go:build added\n\npackage p\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScanner(WithOverlay(map[string]string{
+		filepath.Join(dir, "a.go"):       filepath.Join(root, "a.go"),
+		filepath.Join(dir, "b_linux.go"): "",
+		filepath.Join(dir, "c.go"):       filepath.Join(root, "c.go"),
+	}))
+	report, err := s.Scan(context.Background(), []string{dir})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	want := map[string]int{"new": 1, "added": 1}
+	if got := report.Count(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want Count() = %v, got %v", want, got)
+	}
+}
+
+// TestScannerConcurrency tests that a concurrent Scanner reports the same
+// results as a sequential Scanner.
+func TestScannerConcurrency(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	dirs := make([]string, 0)
+	for i := 0; i < 10; i++ {
+		dir := fmt.Sprintf("p%d", i)
+		for j := 0; j < 10; j++ {
+			name := fmt.Sprintf("%s/file%d_linux.go", dir, j)
+			data := fmt.Sprintf("//go:build tag%d\n\npackage p\n", j)
+			fsys[name] = &fstest.MapFile{Data: []byte(data)}
+		}
+		dirs = append(dirs, dir)
+	}
+
+	want, err := NewScanner().ScanFS(context.Background(), fsys, dirs)
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+	got, err := NewScanner(WithConcurrency(4)).ScanFS(context.Background(), fsys, dirs)
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("concurrent and sequential reports differ")
+	}
+
+	// Errors must be reported too.
+	_, err = NewScanner(WithConcurrency(4)).ScanFS(context.Background(), fsys, append(dirs, "missing"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want err = %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+// TestMerge tests the Merge function.
+func TestMerge(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file_linux.go":  {Data: []byte("package a\n")},
+		"a/file.go":        {Data: []byte("//go:build custom\n\npackage a\n")},
+		"b/file_darwin.go": {Data: []byte("package b\n")},
+	}
+	r1, err := ScanFS(fsys, []string{"a"})
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+	r2, err := ScanFS(fsys, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+
+	report := Merge(r1, r2, nil)
+	if n := len(report.Packages); n != 2 {
+		t.Fatalf("want 2 packages, got %d", n)
+	}
+	want := map[string]int{
+		"linux":  1,
+		"custom": 1,
+		"darwin": 1,
+	}
+	if got := report.Count(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want Count() = %v, got %v", want, got)
+	}
+
+	// The ignored files are not scanned, and are only known from go list.
+	r3 := &Report{Packages: []*Package{{
+		Dir:               "a",
+		IgnoredGoFiles:    []string{"x_windows.go", "y.go"},
+		IgnoredOtherFiles: []string{"z_windows.c"},
+	}}}
+	r4 := &Report{Packages: []*Package{{
+		Dir:            "a",
+		IgnoredGoFiles: []string{"y.go", "w_darwin.go"},
+	}}}
+	pkg := Merge(r3, r4).Packages[0]
+	if want := []string{"x_windows.go", "y.go", "w_darwin.go"}; !reflect.DeepEqual(pkg.IgnoredGoFiles, want) {
+		t.Errorf("want IgnoredGoFiles = %q, got %q", want, pkg.IgnoredGoFiles)
+	}
+	if want := []string{"z_windows.c"}; !reflect.DeepEqual(pkg.IgnoredOtherFiles, want) {
+		t.Errorf("want IgnoredOtherFiles = %q, got %q", want, pkg.IgnoredOtherFiles)
+	}
+}
+
+// TestParseFile tests the ParseFileName, ParseHeader and ParseFile functions.
+func TestParseFile(t *testing.T) {
+	const src = "// +build custom\n\n//go:build custom\n\npackage a\n"
+
+	goos, goarch := ParseFileName("dir.d/file_linux_amd64_test.go")
+	if goos != "linux" || goarch != "amd64" {
+		t.Errorf("want ParseFileName = linux, amd64, got %s, %s", goos, goarch)
+	}
+
+	constraints, err := ParseHeader("file.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseHeader: %v", err)
+	}
+	if n := len(constraints); n != 2 {
+		t.Fatalf("want 2 constraints, got %d", n)
+	}
+	if c := constraints[1]; c.Line != 3 || c.Origin != GoBuild {
+		t.Errorf("want constraint at line 3 with origin %s, got %d %s", GoBuild, c.Line, c.Origin)
+	}
+
+	file, err := ParseFile("dir/file_windows.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if file.Name != "file_windows.go" {
+		t.Errorf("want Name = file_windows.go, got %s", file.Name)
+	}
+	if file.Ignored() {
+		t.Errorf("want Ignored() = false, got true")
+	}
+	if n := len(file.Tags); n != 2 {
+		t.Errorf("want 2 tags, got %d", n)
+	}
+
+	if _, err := ParseHeader("file.go", []byte("//go:build (\n\npackage a\n")); err == nil {
+		t.Error("expected err != nil")
+	}
+}
+
+// TestMisplaced tests that the build constraints after the file header are
+// reported.
+func TestMisplaced(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []int
+	}{
+		{"a.go", "//go:build linux\n\npackage a\n", nil},
+		{"a.go", "package a\n\n//go:build linux\n", []int{3}},
+		{"a.go", "// Package a.\npackage a\n\n// +build linux\n\nfunc f() {\n\t//go:build cgo\n}\n", []int{4, 7}},
+		{"a.go", "package a\n\nconst tmpl = `\n//go:build {{.Tags}}\n`\n", nil},
+		{"a.go", "package a\n\n/*\n//go:build linux\n*/\n", nil},
+		{"a.s", "// +build amd64\n\nTEXT ·f(SB),0,$0\n// +build linux\n", []int{4}},
+		{"a.syso", "", nil},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		if !reflect.DeepEqual(file.Misplaced, test.want) {
+			t.Errorf("ParseFile(%q): want misplaced %v, got %v", test.src, test.want, file.Misplaced)
+		}
+	}
+}
+
+// TestUnseparated tests that the // +build lines not followed by a blank line
+// are reported, and ignored like the go command does.
+func TestUnseparated(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []int
+		expr string // expression in effect, or empty if none
+		tags int    // number of tags
+	}{
+		{"a.go", "// +build linux\n\npackage a\n", nil, "linux", 1},
+		{"a.go", "// +build linux\npackage a\n", []int{1}, "", 0},
+		{"a.go", "// +build linux\n// Package a.\npackage a\n", []int{1}, "", 0},
+		{"a.go", "// +build linux\n\n// +build cgo\n// Package a.\npackage a\n", []int{3}, "linux", 1},
+		{"a.go", "//go:build linux\npackage a\n", nil, "linux", 1},
+		{"a.s", "// +build amd64\nTEXT ·f(SB),0,$0\n", []int{1}, "", 0},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		if !reflect.DeepEqual(file.Unseparated, test.want) {
+			t.Errorf("ParseFile(%q): want unseparated %v, got %v", test.src, test.want, file.Unseparated)
+		}
+		got := ""
+		if expr := file.Expr(); expr != nil {
+			got = expr.String()
+		}
+		if got != test.expr {
+			t.Errorf("ParseFile(%q): want Expr() = %q, got %q", test.src, test.expr, got)
+		}
+		if n := len(file.Tags); n != test.tags {
+			t.Errorf("ParseFile(%q): want %d tags, got %d", test.src, test.tags, n)
+		}
+		ctx := BuildContext{GOOS: "windows", GOARCH: "386"}
+		if ok := ctx.MatchFile(file); ok != (test.expr == "") {
+			t.Errorf("ParseFile(%q): want MatchFile(windows) = %t, got %t", test.src, test.expr == "", ok)
+		}
+	}
+}
+
+// TestParseAssembly tests the parsing of the build constraints in assembly
+// files, whose header is the initial run of comments.
+func TestParseAssembly(t *testing.T) {
+	const src = "// Copyright.\n\n/* Block\n   comment. */\n\n//go:build !purego\n\n#include \"textflag.h\"\n\n// +build ignored\n"
+
+	file, err := ParseFile("sum_amd64.s", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if n := len(file.Constraints); n != 1 {
+		t.Fatalf("want 1 constraint, got %d", n)
+	}
+	if c := file.Constraints[0]; c.Line != 6 || c.Expr.String() != "!purego" {
+		t.Errorf("want constraint !purego at line 6, got %s at line %d", c.Expr, c.Line)
+	}
+	got := make([]string, 0)
+	for _, tag := range file.Tags {
+		got = append(got, tag.Name)
+	}
+	if want := []string{"amd64", "purego"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want tags %q, got %q", want, got)
+	}
+}
+
+// TestSourceFiles tests that the cgo sources and headers and the SWIG files
+// are scanned, that only the name of .syso files is used, and that the other
+// files are not scanned.
+func TestSourceFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a.go":                    {Data: []byte("package a\n")},
+		"a/hook_darwin.m":           {Data: []byte("// +build cgo\n\n#include <stdio.h>\n")},
+		"a/zlib.c":                  {Data: []byte("/* zlib. */\n//go:build !purego\n\nint x;\n")},
+		"a/wrap.cc":                 {Data: []byte("//go:build cxx\n")},
+		"a/wrap_arm64.h":            {Data: []byte("// +build !purego\n\n#define X 1\n")},
+		"a/notes.txt":               {Data: []byte("//go:build ignored\n")},
+		"a/hook.mm":                 {Data: []byte("//go:build ignored\n")},
+		"a/start_arm64.sx":          {Data: []byte("//go:build !purego\n")},
+		"a/api_linux.swigcxx":       {Data: []byte("/* SWIG. */\n//go:build swig\n\n%module api\n")},
+		"a/rsrc_windows_amd64.syso": {Data: []byte("//go:build ignored\n")},
+	}
+	report, err := ScanFS(fsys, []string{"a"})
+	if err != nil {
+		t.Fatalf("ScanFS: %v", err)
+	}
+	want := map[string]int{"darwin": 1, "cgo": 1, "purego": 3, "cxx": 1, "arm64": 2, "windows": 1, "amd64": 1, "linux": 1, "swig": 1}
+	if got := report.Count(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want Count() = %v, got %v", want, got)
+	}
+	headers := make([]string, 0)
+	for _, file := range report.Packages[0].Files {
+		if file.Header() {
+			headers = append(headers, file.Name)
+		}
+	}
+	if want := []string{"wrap_arm64.h"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("want headers %q, got %q", want, headers)
+	}
+}
+
+// TestStandalone tests the File.Standalone method.
+func TestStandalone(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"//go:build ignore\n\npackage main\n", true},
+		{"// +build ignore\n\npackage main\n", true},
+		{"//go:build ignore && linux\n\npackage main\n", false},
+		{"//go:build linux\n\npackage main\n", false},
+		{"package main\n", false},
+	}
+	for _, test := range tests {
+		file, err := ParseFile("gen.go", []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile: %v", err)
+		}
+		if got := file.Standalone(); got != test.want {
+			t.Errorf("%q: want Standalone() = %t, got %t", test.src, test.want, got)
+		}
+	}
+}
+
+// TestFileKind tests the File.Kind method.
+func TestFileKind(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want FileKind
+	}{
+		{"a.go", "package a\n", GoFiles},
+		{"a.go", "package a\n\nimport (\n\t\"C\"\n\t\"fmt\"\n)\n", CgoFiles},
+		{"a_test.go", "package a\n", TestGoFiles},
+		{"a_test.go", "package a_test\n", XTestGoFiles},
+		{"a_test.go", "package a\n\nimport \"C\"\n", TestGoFiles},
+		{"a_amd64.s", "#include \"textflag.h\"\n", SFiles},
+		{"a_amd64.S", "#include \"textflag.h\"\n", SFiles},
+		{"a.c", "int x;\n", CFiles},
+		{"a.cpp", "int x;\n", CXXFiles},
+		{"a.m", "int x;\n", MFiles},
+		{"a.h", "int x;\n", HFiles},
+		{"a.f90", "program a\n", FFiles},
+		{"a.swig", "%module a\n", SwigFiles},
+		{"a_windows.syso", "", SysoFiles},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		if got := file.Kind(); got != test.want {
+			t.Errorf("%s: want Kind() = %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+// TestParsename tests the parsename function.
+func TestParsename(t *testing.T) {
+	tests := []struct {
+		name string
+		want [2]string
+	}{
+		{"file.go", [2]string{}},
+		{"file_test.go", [2]string{}},
+		{"file_linux.go", [2]string{"linux"}},
+		{"file_linux_test.go", [2]string{"linux"}},
+		{"file_amd64.go", [2]string{"amd64"}},
+		{"file_linux_amd64.go", [2]string{"amd64", "linux"}},
+		{"file_linux_amd64_test.go", [2]string{"amd64", "linux"}},
+		{"linux.go", [2]string{}},
+		{"file_custom.go", [2]string{}},
+		{"sys_linux_amd64.s", [2]string{"amd64", "linux"}},
+		{"asm_arm64.s", [2]string{"arm64"}},
+		{"hook_darwin.m", [2]string{"darwin"}},
+		{"rsrc_windows_386.syso", [2]string{"386", "windows"}},
+		{"zsys_linux.pb.go", [2]string{"linux"}},
+		{"linux.s", [2]string{}},
+		{"file_wasip1_wasm.go", [2]string{"wasm", "wasip1"}},
+		{"file_linux_loong64.go", [2]string{"loong64", "linux"}},
+	}
+	for _, test := range tests {
+		if got := parsename(test.name); got != test.want {
+			t.Errorf("parsename(%q): want %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+// TestCategorize tests the Categorize function.
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Category
+	}{
+		{"linux", GOOS},
+		{"wasip1", GOOS},
+		{"amd64", GOARCH},
+		{"loong64", GOARCH},
+		{"amd64.v3", MarchLevel},
+		{"arm.5", MarchLevel},
+		{"386.sse2", MarchLevel},
+		{"riscv64.rva20u64", MarchLevel},
+		{"amd64.", BuildTag},
+		{"custom.v2", BuildTag},
+		{"go1", ReleaseTag},
+		{"go1.17", ReleaseTag},
+		{"go1.300", ReleaseTag},
+		{"go1.017", BuildTag},
+		{"go2", BuildTag},
+		{"cgo", SpecialTag},
+		{"gc", Compiler},
+		{"gccgo", Compiler},
+		{"unix", SpecialTag},
+		{"boringcrypto", SpecialTag},
+		{"race", SpecialTag},
+		{"msan", SpecialTag},
+		{"asan", SpecialTag},
+		{"goexperiment.arenas", GoExperiment},
+		{"goexperiment.", BuildTag},
+		{"purego", Convention},
+		{"netgo", StdlibTag},
+		{"osusergo", StdlibTag},
+		{"timetzdata", StdlibTag},
+		{"ignore", Convention},
+		{"gofuzz", FuzzTag},
+		{"gofuzz_libfuzzer", FuzzTag},
+		{"custom", BuildTag},
+	}
+	for _, test := range tests {
+		if got := Categorize(test.tag); got != test.want {
+			t.Errorf("Categorize(%q): want %s, got %s", test.tag, test.want, got)
+		}
+	}
+}
+
+// TestUsePorts tests that the UsePorts function makes the GOOS and GOARCH
+// values of new ports known.
+func TestUsePorts(t *testing.T) {
+	ports := Ports
+	defer func() {
+		Ports = ports
+		delete(knownOS, "newos")
+		delete(knownArch, "newarch")
+	}()
+
+	UsePorts(append(ports, Port{"newos", "newarch"}))
+	if got := Categorize("newos"); got != GOOS {
+		t.Errorf("want Categorize(newos) = %s, got %s", GOOS, got)
+	}
+	if got := Categorize("newarch"); got != GOARCH {
+		t.Errorf("want Categorize(newarch) = %s, got %s", GOARCH, got)
+	}
+	if goos, goarch := ParseFileName("file_newos_newarch.go"); goos != "newos" || goarch != "newarch" {
+		t.Errorf("want newos/newarch, got %s/%s", goos, goarch)
+	}
+}
+
+// TestSuggest tests the Suggest function.
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"linx", "linux"},
+		{"widows", "windows"},
+		{"amd46", "amd64"},
+		{"darwn", "darwin"},
+		{"purgo", "purego"},
+		{"linux", ""},
+		{"integration", ""},
+		{"foo", ""},
+		{"asm", ""},
+	}
+	for _, test := range tests {
+		if got := Suggest(test.tag); got != test.want {
+			t.Errorf("Suggest(%q): want %q, got %q", test.tag, test.want, got)
+		}
+	}
+}
+
+// TestReleaseTags tests the ReleaseTags function.
+func TestReleaseTags(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"go1.3.2", []string{"go1", "go1.1", "go1.2", "go1.3"}},
+		{"go1.2rc1", []string{"go1", "go1.1", "go1.2"}},
+		{"devel go1.1-abcdef", []string{"go1", "go1.1"}},
+		{"unknown", nil},
+	}
+	for _, test := range tests {
+		if got := ReleaseTags(test.version); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ReleaseTags(%q): want %q, got %q", test.version, test.want, got)
+		}
+	}
+}
+
+// TestFirstClassTag tests the FirstClassTag function.
+func TestFirstClassTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"linux", true},
+		{"windows", true},
+		{"arm64", true},
+		{"386", true},
+		{"freebsd", false},
+		{"riscv64", false},
+		{"wasm", false},
+	}
+	for _, test := range tests {
+		if got := FirstClassTag(test.tag); got != test.want {
+			t.Errorf("FirstClassTag(%q): want %t, got %t", test.tag, test.want, got)
+		}
+	}
+}
+
+// TestRemovedTag tests the RemovedTag function.
+func TestRemovedTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"nacl", "go1.14"},
+		{"amd64p32", "go1.14"},
+		{"darwin", ""},
+		{"386", ""},
+		{"riscv", ""},
+	}
+	for _, test := range tests {
+		if got := RemovedTag(test.tag); got != test.want {
+			t.Errorf("RemovedTag(%q): want %q, got %q", test.tag, test.want, got)
+		}
+	}
+}
+
+// TestRemovedOnly tests the RemovedOnly function.
+func TestRemovedOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"sys_darwin_386.go", "package p\n", "[darwin/386]"},
+		{"sys_darwin.go", "//go:build 386 || arm\n\npackage p\n", "[darwin/386 darwin/arm]"},
+		{"sys_darwin.go", "//go:build 386 || arm64\n\npackage p\n", "[]"},
+		{"sys_linux_386.go", "package p\n", "[]"},
+		{"sys.go", "//go:build custom\n\npackage p\n", "[]"},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		if got := fmt.Sprint(RemovedOnly(file)); got != test.want {
+			t.Errorf("RemovedOnly(%q): want %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+// TestNameResidual tests the NameResidual function.
+func TestNameResidual(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		ok   bool
+	}{
+		{"foo_linux.go", "//go:build linux\n\npackage p\n", "<nil>", true},
+		{"foo_linux.go", "//go:build linux || darwin\n\npackage p\n", "<nil>", true},
+		{"foo_linux.go", "//go:build unix\n\npackage p\n", "<nil>", true},
+		{"foo_android.go", "//go:build linux\n\npackage p\n", "<nil>", true},
+		{"foo_linux_amd64.go", "//go:build linux && amd64\n\npackage p\n", "<nil>", true},
+		{"foo_linux.go", "//go:build linux && cgo\n\npackage p\n", "cgo", true},
+		{"foo_linux.go", "//go:build cgo\n\npackage p\n", "cgo", false},
+		{"foo_linux.go", "//go:build amd64\n\npackage p\n", "amd64", false},
+		{"foo_linux.go", "//go:build !linux\n\npackage p\n", "!linux", false},
+		{"foo.go", "//go:build linux\n\npackage p\n", "linux", false},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		x, ok := NameResidual(file)
+		if got := fmt.Sprint(x); got != test.want || ok != test.ok {
+			t.Errorf("NameResidual(%q, %q): want %s, %t, got %s, %t", test.name, test.src, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+// TestNameConflict tests the NameConflict function.
+func TestNameConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want bool
+	}{
+		{"foo_linux.go", "//go:build !linux\n\npackage p\n", true},
+		{"foo_linux.go", "//go:build windows\n\npackage p\n", true},
+		{"foo_linux_arm64.go", "//go:build 386\n\npackage p\n", true},
+		{"foo_linux.go", "//go:build !android\n\npackage p\n", false},
+		{"foo_linux.go", "//go:build cgo && amd64\n\npackage p\n", false},
+		{"foo_linux.go", "//go:build go1.999\n\npackage p\n", false},
+		{"foo_nacl.go", "//go:build !nacl\n\npackage p\n", false},
+		{"foo.go", "//go:build linux && !linux\n\npackage p\n", false},
+		{"foo_windows.s", "//go:build linux\n", true},
+		{"_foo_linux.go", "//go:build linux\n\npackage p\n", false},
+		{".foo_linux.go", "//go:build !linux\n\npackage p\n", false},
+	}
+	for _, test := range tests {
+		file, err := ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatalf("ParseFile(%q): %v", test.name, err)
+		}
+		if got := NameConflict(file); got != test.want {
+			t.Errorf("NameConflict(%q, %q): want %t, got %t", test.name, test.src, test.want, got)
+		}
+	}
+}
+
+// TestLikePlatform tests the LikePlatform function.
+func TestLikePlatform(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Category
+	}{
+		{"js", GOOS},
+		{"wasm", GOARCH},
+		{"wasip2", GOOS},
+		{"riscv32", GOARCH},
+		{"arm32", GOARCH},
+		{"linux", GOOS},
+		{"v2", ""},
+		{"custom", ""},
+		{"wasmer", ""},
+	}
+	for _, test := range tests {
+		if got := LikePlatform(test.tag); got != test.want {
+			t.Errorf("LikePlatform(%q): want %q, got %q", test.tag, test.want, got)
+		}
+	}
+}
+
+// TestSimplify tests the Simplify function.
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"linux", "linux"},
+		{"linux && !cgo", "linux && !cgo"},
+		{"linux || (linux && amd64)", "linux"},
+		{"(linux || darwin) && linux", "linux"},
+		{"!(!linux)", "linux"},
+		{"!(!linux && cgo)", "!(!linux && cgo)"},
+		{"!(!linux && !darwin)", "!(!linux && !darwin)"},
+		{"linux || linux", "linux"},
+		{"linux || android", "linux"},
+		{"unix || darwin", "unix"},
+		{"(linux || darwin) && (cgo || linux || darwin)", "linux || darwin"},
+		{"aix || darwin || dragonfly || freebsd || hurd || illumos || ios || linux || netbsd || openbsd || solaris || android", "unix"},
+		{"aix || darwin || dragonfly || freebsd || hurd || linux || netbsd || openbsd || solaris", "unix"},
+		{"windows || aix || darwin || dragonfly || freebsd || hurd || linux || netbsd || openbsd || solaris", "windows || unix"},
+		{"aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris", "aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris"},
+	}
+	for _, test := range tests {
+		expr, err := constraint.Parse("//go:build " + test.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", test.expr, err)
+		}
+		if got := Simplify(expr).String(); got != test.want {
+			t.Errorf("Simplify(%q): want %q, got %q", test.expr, test.want, got)
+		}
+	}
+}
+
+// TestDescribe tests the Describe function.
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"netgo", "use the pure Go DNS resolver in package net, instead of cgo"},
+		{"linux", "the target operating system is linux"},
+		{"go1.21", "built with Go 1.21 or later"},
+		{"goexperiment.arenas", "the arenas GOEXPERIMENT is enabled"},
+		{"custom", ""},
+	}
+	for _, test := range tests {
+		if got := Describe(test.tag); got != test.want {
+			t.Errorf("Describe(%q): want %q, got %q", test.tag, test.want, got)
+		}
+	}
+}
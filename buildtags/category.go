@@ -0,0 +1,211 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"strings"
+)
+
+// Category is the category of a build tag.
+type Category string
+
+// Build tag categories.
+const (
+	GOOS         Category = "GOOS"
+	GOARCH       Category = "GOARCH"
+	MarchLevel   Category = "march-level"
+	ReleaseTag   Category = "release-tag"
+	Compiler     Category = "compiler"
+	SpecialTag   Category = "special-tag"
+	StdlibTag    Category = "stdlib-tag"
+	GoExperiment Category = "goexperiment"
+	Convention   Category = "convention-tag"
+	FuzzTag      Category = "fuzz-tag"
+	BuildTag     Category = "build-tag"
+)
+
+// Categories is the list of all the build tag categories, in the order they
+// are reported.
+var Categories = []Category{
+	GOOS,
+	GOARCH,
+	MarchLevel,
+	ReleaseTag,
+	Compiler,
+	SpecialTag,
+	StdlibTag,
+	GoExperiment,
+	Convention,
+	FuzzTag,
+	BuildTag,
+}
+
+// List of past, present and future known GOOS and GOARCH values.
+// Taken from cmd/go/internal/imports/build.go in the Go distribution.
+var (
+	knownOS = map[string]bool{
+		"aix":       true,
+		"android":   true,
+		"darwin":    true,
+		"dragonfly": true,
+		"freebsd":   true,
+		"hurd":      true,
+		"illumos":   true,
+		"ios":       true,
+		"js":        true,
+		"linux":     true,
+		"nacl":      true,
+		"netbsd":    true,
+		"openbsd":   true,
+		"plan9":     true,
+		"solaris":   true,
+		"wasip1":    true,
+		"windows":   true,
+		"zos":       true,
+	}
+
+	knownArch = map[string]bool{
+		"386":         true,
+		"amd64":       true,
+		"amd64p32":    true,
+		"arm":         true,
+		"armbe":       true,
+		"arm64":       true,
+		"arm64be":     true,
+		"loong64":     true,
+		"mips":        true,
+		"mipsle":      true,
+		"mips64":      true,
+		"mips64le":    true,
+		"mips64p32":   true,
+		"mips64p32le": true,
+		"ppc":         true,
+		"ppc64":       true,
+		"ppc64le":     true,
+		"riscv":       true,
+		"riscv64":     true,
+		"s390":        true,
+		"s390x":       true,
+		"sparc":       true,
+		"sparc64":     true,
+		"wasm":        true,
+	}
+)
+
+// List of the known GOOS values satisfying the unix build tag.
+// Taken from cmd/go/internal/imports/build.go in the Go distribution.
+var unixOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"linux":     true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"solaris":   true,
+}
+
+// List of the GOOS values implying another GOOS value, as done by the go
+// command: for example, the files for linux are also built for android.
+var impliedOS = map[string]string{
+	"android": "linux",
+	"illumos": "solaris",
+	"ios":     "darwin",
+}
+
+// List of the known compilers, as set by the Compiler field of the build
+// context.
+var knownCompiler = map[string]bool{
+	"gc":    true,
+	"gccgo": true,
+}
+
+// List of know special build tags.
+var knownSpecialTag = map[string]bool{
+	"cgo":  true,
+	"unix": true, // implied by the Unix-like GOOS values, since Go 1.19
+
+	"boringcrypto": true, // set by GOEXPERIMENT=boringcrypto
+
+	// Sanitizers, set by the go build -race, -msan and -asan flags.
+	"race": true,
+	"msan": true,
+	"asan": true,
+}
+
+// isMarchLevel reports whether the build tag is a microarchitecture level tag,
+// set by the toolchain for the architecture feature levels, like amd64.v3 for
+// GOAMD64=v3 or arm.7 for GOARM=7.
+func isMarchLevel(tag string) bool {
+	i := strings.Index(tag, ".")
+
+	return i > 0 && i < len(tag)-1 && knownArch[tag[:i]]
+}
+
+// List of the known tags changing the behavior of the standard library.
+var knownStdlib = map[string]bool{
+	"netgo":            true,
+	"netcgo":           true,
+	"osusergo":         true,
+	"timetzdata":       true,
+	"nethttpomithttp2": true,
+	"math_big_pure_go": true,
+}
+
+// List of the known tags used to build the fuzz targets of the go-fuzz
+// tools, predating the native fuzzing support of Go 1.18.
+var knownFuzz = map[string]bool{
+	"gofuzz":           true,
+	"gofuzz_libfuzzer": true,
+	"libfuzzer":        true,
+}
+
+// List of the known tags defined by ecosystem conventions, instead of the
+// toolchain.
+var knownConvention = map[string]bool{
+	"purego": true, // selects the pure Go fallback of assembly or cgo code
+	"ignore": true, // excludes standalone programs, like generators, from the package
+}
+
+// goexperimentPrefix is the prefix of the tags set by the toolchain for each
+// enabled GOEXPERIMENT, like goexperiment.arenas.
+const goexperimentPrefix = "goexperiment."
+
+// isGoExperiment reports whether the build tag is a goexperiment tag.
+func isGoExperiment(tag string) bool {
+	return strings.HasPrefix(tag, goexperimentPrefix) && len(tag) > len(goexperimentPrefix)
+}
+
+// Categorize returns the category of the build tag.
+func Categorize(tag string) Category {
+	switch {
+	case knownOS[tag]:
+		return GOOS
+	case knownArch[tag]:
+		return GOARCH
+	case isMarchLevel(tag):
+		return MarchLevel
+	case isReleaseTag(tag):
+		return ReleaseTag
+	case knownCompiler[tag]:
+		return Compiler
+	case knownSpecialTag[tag]:
+		return SpecialTag
+	case knownStdlib[tag]:
+		return StdlibTag
+	case isGoExperiment(tag):
+		return GoExperiment
+	case knownConvention[tag]:
+		return Convention
+	case knownFuzz[tag]:
+		return FuzzTag
+	}
+
+	return BuildTag
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+// descriptions is a small knowledge base describing the well-known build
+// tags, other than the GOOS, GOARCH and release tags.
+var descriptions = map[string]string{
+	// Toolchain.
+	"cgo":          "cgo is enabled",
+	"gc":           "built with the gc compiler",
+	"gccgo":        "built with the gccgo compiler",
+	"unix":         "the target is a Unix-like operating system",
+	"race":         "built with the race detector (go build -race)",
+	"msan":         "built with the memory sanitizer (go build -msan)",
+	"asan":         "built with the address sanitizer (go build -asan)",
+	"boringcrypto": "crypto uses the BoringCrypto module (GOEXPERIMENT=boringcrypto)",
+
+	// Standard library behavior.
+	"netgo":            "use the pure Go DNS resolver in package net, instead of cgo",
+	"netcgo":           "use the cgo DNS resolver in package net",
+	"osusergo":         "use the pure Go user and group lookup in package os/user, instead of cgo",
+	"timetzdata":       "embed the time zone database in the binary (like importing time/tzdata)",
+	"nethttpomithttp2": "omit the HTTP/2 support from package net/http",
+	"math_big_pure_go": "use the pure Go implementation of package math/big",
+
+	// Ecosystem conventions.
+	"purego":       "use the pure Go fallback instead of assembly or cgo code",
+	"ignore":       "exclude the file from the package, like a code generator run with go run",
+	"static_build": "build a statically linked binary",
+	"tools":        "track the tool dependencies in a tools.go file",
+	"integration":  "enable the integration tests",
+	"appengine":    "built for the legacy Google App Engine standard environment",
+	"tinygo":       "built with the TinyGo compiler",
+
+	// Fuzzing.
+	"gofuzz":           "built as a go-fuzz fuzz target",
+	"gofuzz_libfuzzer": "built as a go-fuzz fuzz target for libFuzzer",
+	"libfuzzer":        "built as a fuzz target for libFuzzer",
+}
+
+// Describe returns a short description of the well-known build tag, like
+// netgo or purego, or an empty string if the tag is not known.
+func Describe(tag string) string {
+	switch {
+	case knownOS[tag]:
+		return "the target operating system is " + tag
+	case knownArch[tag]:
+		return "the target architecture is " + tag
+	case isReleaseTag(tag):
+		return "built with Go " + tag[len("go"):] + " or later"
+	case isGoExperiment(tag):
+		return "the " + tag[len(goexperimentPrefix):] + " GOEXPERIMENT is enabled"
+	}
+
+	return descriptions[tag]
+}
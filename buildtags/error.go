@@ -0,0 +1,55 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"errors"
+	"go/scanner"
+	"io/fs"
+	"strconv"
+)
+
+// ScanError is the error returned when a file or a package directory can not
+// be scanned.
+type ScanError struct {
+	File string // path of the file or directory
+	Line int    // line number, starting at 1, or 0 if unknown
+	Err  error  // the underlying error
+}
+
+// Error implements the error interface.
+func (e *ScanError) Error() string {
+	msg := e.File
+	if e.Line > 0 {
+		msg += ":" + strconv.Itoa(e.Line)
+	}
+
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap implements the Wrapper interface.
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// newerror returns a new ScanError for the error err occurred at the
+// specified file and line.
+//
+// In order to avoid reporting the position twice, the position included in a
+// *fs.PathError or a scanner.ErrorList is removed.
+func newerror(path string, line int, err error) *ScanError {
+	var perr *fs.PathError
+	var list scanner.ErrorList
+
+	switch {
+	case errors.As(err, &perr):
+		err = perr.Err
+	case errors.As(err, &list) && len(list) > 0:
+		line = list[0].Pos.Line
+		err = errors.New(list[0].Msg)
+	}
+
+	return &ScanError{File: path, Line: line, Err: err}
+}
@@ -0,0 +1,324 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The code for the matchtag method has been adapted from the matchTag method
+// from src/go/build/build.go in the Go source distribution.
+// Copyright 2011 The Go Authors. All rights reserved.
+
+package buildtags
+
+import (
+	"fmt"
+	"go/build"
+	"go/build/constraint"
+)
+
+// BuildContext is a build configuration used to evaluate build constraints.
+type BuildContext struct {
+	GOOS        string   // target operating system
+	GOARCH      string   // target architecture
+	Compiler    string   // compiler to assume; "gc" if empty
+	CgoEnabled  bool     // whether cgo files are included
+	Tags        []string // additional tags to consider satisfied
+	ReleaseTags []string // release tags to consider satisfied, like "go1.17"
+}
+
+// DefaultContext returns the build context of the host, as reported by the
+// go/build package.
+func DefaultContext() BuildContext {
+	return BuildContext{
+		GOOS:        build.Default.GOOS,
+		GOARCH:      build.Default.GOARCH,
+		Compiler:    build.Default.Compiler,
+		CgoEnabled:  build.Default.CgoEnabled,
+		Tags:        build.Default.BuildTags,
+		ReleaseTags: build.Default.ReleaseTags,
+	}
+}
+
+// Match is the result of evaluating a file in a build context.
+type Match struct {
+	Package  *Package // the package containing the file
+	File     *File    // the evaluated file
+	Included bool     // whether the file is included in the build
+}
+
+// Evaluate reports, for each file in the report, whether the file would be
+// included or excluded when building with the build context ctx.
+//
+// Like the go command, files with a name starting with "_" or "." are always
+// excluded, and the Go files importing "C" are excluded when cgo is disabled.
+func (r *Report) Evaluate(ctx BuildContext) []*Match {
+	list := make([]*Match, 0)
+	for _, pkg := range r.Packages {
+		for _, file := range pkg.Files {
+			m := &Match{
+				Package:  pkg,
+				File:     file,
+				Included: ctx.MatchFile(file),
+			}
+			list = append(list, m)
+		}
+	}
+
+	return list
+}
+
+// MatchFile reports whether the file would be included when building with
+// the build context ctx, using both the file name and the file header build
+// constraints.  Like the go/build package, a Go file importing "C" is only
+// included when cgo is enabled.
+func (ctx BuildContext) MatchFile(file *File) bool {
+	if file.Ignored() {
+		return false
+	}
+	if !ctx.matchname(file.Name) {
+		return false
+	}
+	if file.Kind() == CgoFiles && !ctx.CgoEnabled {
+		return false
+	}
+	if expr := file.Expr(); expr != nil {
+		return expr.Eval(ctx.matchtag)
+	}
+
+	return true
+}
+
+// Explanation explains why a file is included or excluded in a build context.
+type Explanation struct {
+	Included bool     // whether the file is included in the build
+	Reasons  []string // human readable reasons, in the order they are checked
+}
+
+// Explain returns an explanation of why the file is included or excluded when
+// building with the build context ctx.  Each file name suffix and each
+// constraint line in effect is reported, followed by the tags that determine
+// its value.
+func (ctx BuildContext) Explain(file *File) *Explanation {
+	e := &Explanation{
+		Included: ctx.MatchFile(file),
+		Reasons:  make([]string, 0),
+	}
+	if file.Ignored() {
+		e.Reasons = append(e.Reasons, "file name starts with \"_\" or \".\": ignored by the go command")
+	}
+
+	goos, goarch := ParseFileName(file.Name)
+	if goos != "" {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("file name requires GOOS=%s: %s",
+			goos, status(ctx.matchtag(goos))))
+	}
+	if goarch != "" {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("file name requires GOARCH=%s: %s",
+			goarch, status(ctx.matchtag(goarch))))
+	}
+
+	if file.Kind() == CgoFiles {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("file imports \"C\", requires cgo: %s",
+			status(ctx.CgoEnabled)))
+	}
+	if file.BinaryOnly {
+		e.Reasons = append(e.Reasons, "file marks a binary-only package, no longer supported by the go command")
+	}
+
+	// Like the go command, when a //go:build line is present the // +build
+	// lines are ignored.
+	constraints := file.Constraints
+	for _, c := range file.Constraints {
+		if c.Origin == GoBuild {
+			constraints = []*Constraint{c}
+
+			break
+		}
+	}
+	for _, c := range constraints {
+		ok := c.Expr.Eval(ctx.matchtag)
+		e.Reasons = append(e.Reasons, fmt.Sprintf("line %d: %s constraint %q: %s",
+			c.Line, c.Origin, c.Expr.String(), status(ok)))
+		for _, leaf := range ctx.explain(c.Expr, ok, nil) {
+			e.Reasons = append(e.Reasons, "\t"+leaf)
+		}
+	}
+
+	return e
+}
+
+// explain appends to list the tags in expr that cause expr to evaluate to
+// value, and returns the extended list.
+func (ctx BuildContext) explain(expr constraint.Expr, value bool, list []string) []string {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		leaf := fmt.Sprintf("%s is %t", x.Tag, value)
+		for _, v := range list {
+			if v == leaf {
+				return list
+			}
+		}
+		list = append(list, leaf)
+	case *constraint.NotExpr:
+		list = ctx.explain(x.X, !value, list)
+	case *constraint.AndExpr:
+		// A true conjunction requires both operands, a false one only the
+		// false operands.
+		for _, y := range []constraint.Expr{x.X, x.Y} {
+			if value || !y.Eval(ctx.matchtag) {
+				list = ctx.explain(y, value, list)
+			}
+		}
+	case *constraint.OrExpr:
+		for _, y := range []constraint.Expr{x.X, x.Y} {
+			if !value || y.Eval(ctx.matchtag) {
+				list = ctx.explain(y, value, list)
+			}
+		}
+	}
+
+	return list
+}
+
+// Residual returns the part of the build constraint expr that still varies
+// after assuming that the tags for which assumed returns true are satisfied.
+// If the value of expr no longer depends on the other tags, Residual returns
+// nil and that value.
+//
+// Tags not assumed are left unknown, so assuming GOOS=linux does not make the
+// other GOOS values false.
+func Residual(expr constraint.Expr, assumed func(tag string) bool) (constraint.Expr, bool) {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		if assumed(x.Tag) {
+			return nil, true
+		}
+	case *constraint.NotExpr:
+		y, ok := Residual(x.X, assumed)
+		if y == nil {
+			return nil, !ok
+		}
+
+		return &constraint.NotExpr{X: y}, false
+	case *constraint.AndExpr:
+		a, aok := Residual(x.X, assumed)
+		b, bok := Residual(x.Y, assumed)
+		switch {
+		case a == nil && !aok, b == nil && !bok:
+			return nil, false
+		case a == nil:
+			return b, bok
+		case b == nil:
+			return a, aok
+		}
+
+		return &constraint.AndExpr{X: a, Y: b}, false
+	case *constraint.OrExpr:
+		a, aok := Residual(x.X, assumed)
+		b, bok := Residual(x.Y, assumed)
+		switch {
+		case a == nil && aok, b == nil && bok:
+			return nil, true
+		case a == nil:
+			return b, bok
+		case b == nil:
+			return a, aok
+		}
+
+		return &constraint.OrExpr{X: a, Y: b}, false
+	}
+
+	return expr, false
+}
+
+// NameResidual returns the part of the build constraint of file that still
+// varies after assuming the GOOS and GOARCH values in the file name, like
+// Residual, and reports whether the constraint repeats the file name, like
+// //go:build linux in foo_linux.go.  The returned expression can replace the
+// constraint, and it is nil if the whole constraint is implied by the name.
+func NameResidual(file *File) (constraint.Expr, bool) {
+	expr := file.Expr()
+	goos, goarch := ParseFileName(file.Name)
+	if expr == nil || goos == "" && goarch == "" {
+		return expr, false
+	}
+
+	ctx := BuildContext{GOOS: goos, GOARCH: goarch}
+	assumed := func(tag string) bool {
+		switch c := Categorize(tag); {
+		case goos != "" && (c == GOOS || tag == "unix"):
+			return ctx.matchtag(tag)
+		case goarch != "" && c == GOARCH:
+			return ctx.matchtag(tag)
+		}
+
+		return false
+	}
+	x, ok := Residual(expr, assumed)
+	switch {
+	case x == nil && ok:
+		return nil, true
+	case x == nil:
+		// The constraint contradicts the name, and it is reported
+		// by NameConflict.
+		return expr, false
+	}
+
+	return x, x.String() != expr.String()
+}
+
+// status returns a description of a constraint value.
+func status(ok bool) string {
+	if ok {
+		return "satisfied"
+	}
+
+	return "not satisfied"
+}
+
+// matchname reports whether the GOOS and GOARCH specified in the file name are
+// satisfied by ctx.
+func (ctx BuildContext) matchname(name string) bool {
+	autotags := parsename(name)
+	for _, tag := range autotags {
+		if tag != "" && !ctx.matchtag(tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchTag reports whether the build tag is satisfied by ctx.
+func (ctx BuildContext) MatchTag(tag string) bool {
+	return ctx.matchtag(tag)
+}
+
+// matchtag reports whether the tag is satisfied by ctx.
+func (ctx BuildContext) matchtag(tag string) bool {
+	compiler := ctx.Compiler
+	if compiler == "" {
+		compiler = "gc"
+	}
+
+	switch {
+	case ctx.CgoEnabled && tag == "cgo":
+		return true
+	case tag == ctx.GOOS || tag == ctx.GOARCH || tag == compiler:
+		return true
+	case tag == "unix" && unixOS[ctx.GOOS]:
+		return true
+	case tag == impliedOS[ctx.GOOS]:
+		return true
+	}
+	for _, t := range ctx.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	for _, t := range ctx.ReleaseTags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/perillo/go-buildtags/internal/invoke"
+)
+
+// hostFormat is the go list template printing the build context, one field
+// or list of tags per line.
+const hostFormat = `{{context.GOOS}}
+{{context.GOARCH}}
+{{context.Compiler}}
+{{context.CgoEnabled}}
+{{join context.ToolTags " "}}
+{{join context.BuildTags " "}}
+{{join context.ReleaseTags " "}}`
+
+// HostTags returns all the tags satisfied by the default build of the go
+// command, taken live from the build context reported by go list and using
+// the GoEnv environment variables: the GOOS and GOARCH values, including the
+// implied ones like unix, the compiler, cgo if enabled, the tool tags like the
+// GOARCH feature levels and the GOEXPERIMENT tags, the tags specified with
+// -tags in GOFLAGS and the release tags.
+func HostTags(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, GoCmd, "list", "-f", hostFormat, "runtime")
+	if len(GoEnv) > 0 {
+		cmd.Env = append(os.Environ(), GoEnv...)
+	}
+	stdout, err := invoke.Output(cmd)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(stdout), "\n")
+	if len(lines) < 7 {
+		return nil, fmt.Errorf("host tags: unexpected go list output %q", stdout)
+	}
+
+	goos, goarch := lines[0], lines[1]
+	tags := []string{goos}
+	if implied := impliedOS[goos]; implied != "" {
+		tags = append(tags, implied)
+	}
+	if unixOS[goos] {
+		tags = append(tags, "unix")
+	}
+	tags = append(tags, goarch, lines[2])
+	if lines[3] == "true" {
+		tags = append(tags, "cgo")
+	}
+	for _, line := range lines[4:7] {
+		tags = append(tags, strings.Fields(line)...)
+	}
+
+	return tags, nil
+}
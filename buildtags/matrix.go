@@ -0,0 +1,209 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxMatrixTags is the maximum number of tags in a file for which all the
+// combinations are tried by Matrix.  For files with more tags, only the
+// combinations with no tags and all tags are tried.
+const maxMatrixTags = 10
+
+// Matrix returns a set of build contexts, derived from base, that together
+// include every file in the report, so that each file is compiled in at least
+// one of them.  The contexts are selected from the known Ports, setting the
+// other build tags, like the custom tags, purego and cgo, as needed.
+//
+// The files that are not included in any context, like the files ignored by
+// the go command or with an unsatisfiable constraint, are returned as
+// matches with Included set to false.
+//
+// Matrix uses a greedy algorithm, so the returned set is small but not
+// necessarily minimal.  On ties, the port of base is preferred, so that the
+// files without constraints are built for the GOOS and GOARCH of base.
+func (r *Report) Matrix(base BuildContext) ([]BuildContext, []*Match) {
+	type entry struct {
+		pkg  *Package
+		file *File
+	}
+
+	// Collect the files and the candidate contexts.
+	files := make([]entry, 0)
+	candidates := make([]BuildContext, 0)
+	seen := make(map[string]bool)
+	for _, pkg := range r.Packages {
+		for _, file := range pkg.Files {
+			files = append(files, entry{pkg, file})
+		}
+	}
+	// The ports with a GOOS implying another one, like android, are only
+	// tried for the files not included by the other ports, so that the
+	// files for linux are built with GOOS=linux.
+	exact := make(map[*File]bool)
+	for _, implied := range []bool{false, true} {
+		for _, port := range ports(base) {
+			if (impliedOS[port.GOOS] != "") != implied {
+				continue
+			}
+			for _, e := range files {
+				if implied && exact[e.file] {
+					continue
+				}
+				ctx, ok := satisfy(base, port, e.file)
+				if !ok {
+					continue
+				}
+				if !implied {
+					exact[e.file] = true
+				}
+				if key := ctx.key(); !seen[key] {
+					seen[key] = true
+					candidates = append(candidates, ctx)
+				}
+			}
+		}
+	}
+
+	// Select the contexts covering most of the remaining files.
+	uncovered := files
+	matrix := make([]BuildContext, 0)
+	for len(uncovered) > 0 {
+		best, count := -1, 0
+		for i, ctx := range candidates {
+			n := 0
+			for _, e := range uncovered {
+				if ctx.MatchFile(e.file) {
+					n++
+				}
+			}
+			if n > count {
+				best, count = i, n
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		ctx := candidates[best]
+		matrix = append(matrix, ctx)
+		remaining := make([]entry, 0, len(uncovered)-count)
+		for _, e := range uncovered {
+			if !ctx.MatchFile(e.file) {
+				remaining = append(remaining, e)
+			}
+		}
+		uncovered = remaining
+	}
+
+	excluded := make([]*Match, 0, len(uncovered))
+	for _, e := range uncovered {
+		excluded = append(excluded, &Match{Package: e.pkg, File: e.file})
+	}
+
+	return matrix, excluded
+}
+
+// ports returns the known Ports, with the port of base first if it is a known
+// port.
+func ports(base BuildContext) []Port {
+	first := Port{base.GOOS, base.GOARCH}
+	list := make([]Port, 0, len(Ports))
+	for _, port := range Ports {
+		if port == first {
+			list = append([]Port{port}, list...)
+		} else {
+			list = append(list, port)
+		}
+	}
+
+	return list
+}
+
+// satisfy returns a build context, derived from base and using the port, that
+// includes the file.  The toggled build tags and cgo are set as needed, trying
+// the combinations with fewer tags first.  Cgo is always enabled for the Go
+// files importing "C".
+func satisfy(base BuildContext, port Port, file *File) (BuildContext, bool) {
+	tags := make([]string, 0)
+	for _, tag := range file.Tags {
+		if toggled(tag) {
+			tags = append(tags, tag.Name)
+		}
+	}
+	sort.Strings(tags)
+
+	subsets := [][]string{nil, tags}
+	if len(tags) <= maxMatrixTags {
+		subsets = combinations(tags)
+	}
+	for _, subset := range subsets {
+		ctx := base
+		ctx.GOOS = port.GOOS
+		ctx.GOARCH = port.GOARCH
+		ctx.Tags = append([]string(nil), base.Tags...)
+		if file.Kind() == CgoFiles {
+			ctx.CgoEnabled = true
+		}
+		for _, tag := range subset {
+			if tag == "cgo" {
+				ctx.CgoEnabled = true
+
+				continue
+			}
+			ctx.Tags = append(ctx.Tags, tag)
+		}
+		if ctx.MatchFile(file) {
+			return ctx, true
+		}
+	}
+
+	return BuildContext{}, false
+}
+
+// toggled reports whether the tag can be set in a build context to include a
+// file, like a custom tag, purego, netgo or cgo.  The tags determined by the
+// port, the compiler and the Go release, including unix, are never set.
+func toggled(tag *Tag) bool {
+	switch tag.Category {
+	case GOOS, GOARCH, MarchLevel, ReleaseTag, Compiler:
+		return false
+	}
+
+	return tag.Name != "unix"
+}
+
+// combinations returns all the subsets of tags, ordered by size.
+func combinations(tags []string) [][]string {
+	n := len(tags)
+	list := make([][]string, 0, 1<<n)
+	for mask := 0; mask < 1<<n; mask++ {
+		subset := make([]string, 0)
+		for i, tag := range tags {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, tag)
+			}
+		}
+		list = append(list, subset)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return len(list[i]) < len(list[j])
+	})
+
+	return list
+}
+
+// key returns a string uniquely identifying the build context, ignoring the
+// release tags and the compiler.
+func (ctx BuildContext) key() string {
+	tags := append([]string(nil), ctx.Tags...)
+	sort.Strings(tags)
+
+	return ctx.GOOS + "/" + ctx.GOARCH + " " + strconv.FormatBool(ctx.CgoEnabled) + " " +
+		strings.Join(tags, ",")
+}
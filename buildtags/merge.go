@@ -0,0 +1,91 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+// Merge returns a new report combining the packages in all the reports, like
+// the results of scanning several modules or of incremental scans.
+//
+// Packages with the same directory are merged into a single package, and
+// files with the same name in the same package are reported only once, using
+// the first occurrence.  Since the report tags are computed from the files,
+// tags are de-duplicated too.
+//
+// The packages in the returned report are new values, but the files are
+// shared with the original reports.
+func Merge(reports ...*Report) *Report {
+	merged := &Report{Packages: make([]*Package, 0)}
+	index := make(map[string]*Package)
+	for _, r := range reports {
+		if r == nil {
+			continue
+		}
+		for _, pkg := range r.Packages {
+			p, ok := index[pkg.Dir]
+			if !ok {
+				p = &Package{
+					Dir:        pkg.Dir,
+					ImportPath: pkg.ImportPath,
+					Name:       pkg.Name,
+					Module:     pkg.Module,
+					Files:      make([]*File, 0, len(pkg.Files)),
+				}
+				index[pkg.Dir] = p
+				merged.Packages = append(merged.Packages, p)
+			}
+			p.merge(pkg)
+		}
+	}
+
+	return merged
+}
+
+// merge adds to p the files and the ignored files in pkg not already in p,
+// and sets the package metadata not known by p.
+func (p *Package) merge(pkg *Package) {
+	if p.ImportPath == "" {
+		p.ImportPath = pkg.ImportPath
+	}
+	if p.Name == "" {
+		p.Name = pkg.Name
+	}
+	if p.Module == nil {
+		p.Module = pkg.Module
+	}
+
+	for _, file := range pkg.Files {
+		if p.file(file.Name) == nil {
+			p.Files = append(p.Files, file)
+		}
+	}
+	p.IgnoredGoFiles = union(p.IgnoredGoFiles, pkg.IgnoredGoFiles)
+	p.IgnoredOtherFiles = union(p.IgnoredOtherFiles, pkg.IgnoredOtherFiles)
+}
+
+// union appends to list the names not already in list, and returns the
+// extended list.
+func union(list, names []string) []string {
+	for _, name := range names {
+		found := false
+		for _, s := range list {
+			found = found || s == name
+		}
+		if !found {
+			list = append(list, name)
+		}
+	}
+
+	return list
+}
+
+// file returns the named file in p, or nil if not found.
+func (p *Package) file(name string) *File {
+	for _, file := range p.Files {
+		if file.Name == name {
+			return file
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// overlayFS is a file system that provides access to the operating system
+// files, like osFS, but with some files replaced as specified by the go
+// command -overlay flag.
+type overlayFS struct {
+	// replace maps the absolute path of a file to the path of the file
+	// replacing it, or to an empty string if the file is deleted.
+	replace map[string]string
+}
+
+// newoverlay returns an overlayFS for the replacements, where the paths of
+// the replaced files are absolute or relative to the current directory.
+func newoverlay(replace map[string]string) *overlayFS {
+	o := &overlayFS{replace: make(map[string]string)}
+	for name, with := range replace {
+		if abs, err := filepath.Abs(name); err == nil {
+			name = abs
+		}
+		o.replace[filepath.Clean(name)] = with
+	}
+
+	return o
+}
+
+// lookup returns the path of the file replacing the named file, reporting
+// whether the file is replaced.
+func (o *overlayFS) lookup(name string) (string, bool) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", false
+	}
+	with, ok := o.replace[abs]
+
+	return with, ok
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if with, ok := o.lookup(name); ok {
+		if with == "" {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		name = with
+	}
+
+	return os.Open(name)
+}
+
+func (o *overlayFS) ReadFile(name string) ([]byte, error) {
+	if with, ok := o.lookup(name); ok {
+		if with == "" {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		name = with
+	}
+
+	return os.ReadFile(name)
+}
+
+// ReadDir returns the entries of the named directory, without the deleted
+// files and with the files added by the overlay, sorted by name.  Like the go
+// command, the directory may only exist in the overlay.
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	missing := err != nil
+
+	list := make([]fs.DirEntry, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, d := range entries {
+		seen[d.Name()] = true
+		if with, ok := o.replace[filepath.Join(dir, d.Name())]; ok {
+			if with == "" {
+				continue
+			}
+			fi, err := os.Stat(with)
+			if err != nil {
+				return nil, err
+			}
+			d = &overlayEntry{name: d.Name(), fi: fi}
+		}
+		list = append(list, d)
+	}
+	for path, with := range o.replace {
+		if filepath.Dir(path) != dir || seen[filepath.Base(path)] || with == "" {
+			continue
+		}
+		fi, err := os.Stat(with)
+		if err != nil {
+			return nil, err
+		}
+		missing = false
+		list = append(list, &overlayEntry{name: filepath.Base(path), fi: fi})
+	}
+	if missing {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+
+	return list, nil
+}
+
+// overlayEntry is a directory entry for a file replaced or added by the
+// overlay.
+type overlayEntry struct {
+	name string      // name of the file in the directory
+	fi   fs.FileInfo // information about the replacement file
+}
+
+func (e *overlayEntry) Name() string               { return e.name }
+func (e *overlayEntry) IsDir() bool                { return e.fi.IsDir() }
+func (e *overlayEntry) Type() fs.FileMode          { return e.fi.Mode().Type() }
+func (e *overlayEntry) Info() (fs.FileInfo, error) { return e.fi, nil }
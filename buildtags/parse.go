@@ -0,0 +1,516 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The code for the parsename function has been adapted from the goodOSArchFile
+// method from src/go/build/build.go in the Go source distribution.
+// Copyright 2011 The Go Authors. All rights reserved.
+
+package buildtags
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// osFS is a file system that provides access to the operating system files,
+// using native paths.  Unlike the file system returned by os.DirFS, it
+// accepts absolute and relative paths.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// join joins the path elements, using the path syntax of fsys.
+func join(fsys fs.FS, elem ...string) string {
+	switch fsys.(type) {
+	case osFS, *overlayFS:
+		return filepath.Join(elem...)
+	}
+
+	return path.Join(elem...)
+}
+
+// extKinds maps the extension of the source files scanned in a package
+// directory, other than Go files, to their kind.  The extensions are the same
+// recognized by the go/build package, so that the same files participate in
+// the constraint evaluation.
+//
+// Objective-C++ .mm files are intentionally not included: go/build does not
+// recognize them and the go command never compiles them, so their build
+// constraints have no effect.
+var extKinds = map[string]FileKind{
+	".c":       CFiles,
+	".cc":      CXXFiles,
+	".cpp":     CXXFiles,
+	".cxx":     CXXFiles,
+	".m":       MFiles,
+	".h":       HFiles,
+	".hh":      HFiles,
+	".hpp":     HFiles,
+	".hxx":     HFiles,
+	".f":       FFiles,
+	".F":       FFiles,
+	".for":     FFiles,
+	".f90":     FFiles,
+	".s":       SFiles,
+	".S":       SFiles,
+	".sx":      SFiles,
+	".swig":    SwigFiles,
+	".swigcxx": SwigCXXFiles,
+	".syso":    SysoFiles,
+}
+
+// isobject reports whether the named file is a .syso object file, whose build
+// tags can only be specified in the file name.
+func isobject(name string) bool {
+	return filepath.Ext(name) == ".syso"
+}
+
+// isheader reports whether the named file is a C or C++ header file.
+func isheader(name string) bool {
+	return extKinds[filepath.Ext(name)] == HFiles
+}
+
+// issource reports whether the named file is a source file that can have
+// build constraints.
+func issource(name string) bool {
+	ext := filepath.Ext(name)
+	_, ok := extKinds[ext]
+
+	return ext == ".go" || ok
+}
+
+// readdir returns a list of all the source files in the specified package
+// directory.  When follow is true, symbolic links to regular files are
+// included too; broken links are ignored.
+func readdir(fsys fs.FS, dir string, follow bool) ([]string, error) {
+	list := make([]string, 0)
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, newerror(dir, 0, err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !issource(name) {
+			continue
+		}
+		mode := file.Type()
+		if follow && mode&fs.ModeSymlink != 0 {
+			fi, err := fs.Stat(fsys, join(fsys, dir, name))
+			if err != nil {
+				continue
+			}
+			mode = fi.Mode().Type()
+		}
+		if mode == 0 {
+			list = append(list, name)
+		}
+	}
+
+	return list, nil
+}
+
+// parsename returns the tags specified in the file name.  Like go/build, the
+// suffixes are recognized for all the kinds of files, like sys_linux_amd64.s,
+// and everything after the first dot is ignored.
+func parsename(name string) (tags [2]string) {
+	// Strip the file extension.
+	if dot := strings.Index(name, "."); dot != -1 {
+		name = name[:dot]
+	}
+
+	// Skip normal files.
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return tags
+	}
+
+	l := strings.Split(name[i+1:], "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+
+	if n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]] {
+		return [2]string{l[n-1], l[n-2]}
+	}
+	if n >= 1 && (knownOS[l[n-1]] || knownArch[l[n-1]]) {
+		return [2]string{l[n-1]}
+	}
+
+	return tags
+}
+
+// ParseFileName returns the GOOS and GOARCH values specified in the file name,
+// like in file_linux_amd64.go or sys_linux_amd64.s.  An empty string is
+// returned for a value that is not specified.
+func ParseFileName(name string) (goos, goarch string) {
+	autotags := parsename(filepath.Base(name))
+	for _, tag := range autotags {
+		switch {
+		case knownOS[tag]:
+			goos = tag
+		case knownArch[tag]:
+			goarch = tag
+		}
+	}
+
+	return goos, goarch
+}
+
+// ParseHeader returns the build constraints in the header of the Go source
+// src, from the start of the file until the package clause.  For other source
+// files, like assembly and cgo C files, the header is the initial run of
+// comments.  The name is used to select the kind of file and to report errors.
+//
+// Like the go command, the // +build lines not followed by a blank line are
+// ignored.
+func ParseHeader(name string, src []byte) ([]*Constraint, error) {
+	info, err := parseheader(name, src)
+	if err != nil {
+		return nil, err
+	}
+
+	constraints, err := parseconstraints(name, info.header)
+	if err != nil {
+		return nil, err
+	}
+
+	return without(constraints, unseparated(info.header, constraints)), nil
+}
+
+// ParseFile returns the build tags and constraints specified in the name and
+// in the header of the Go source src.  The name may be a path, and it is used
+// in the tag positions.
+//
+// Like ParseFileName and ParseHeader, ParseFile does not access the file
+// system, so it can be used to classify an editor buffer.
+func ParseFile(name string, src []byte) (*File, error) {
+	return parsefile(name, filepath.Base(name), src)
+}
+
+// fileinfo is the information about a source file read from its header.
+type fileinfo struct {
+	header  []byte // file header, where build constraints can be specified
+	pkgname string // package name, for Go files
+	cgo     bool   // whether the Go file imports "C"
+}
+
+// parseheader returns the information in the file header, where build
+// constraints can be specified.  For Go files, the header extends from the
+// start of the file until the start of the package statement; for the other
+// source files, like assembly, cgo C and SWIG files, the header is the
+// initial run of blank lines and comments.  Object files have no header.
+func parseheader(path string, src []byte) (*fileinfo, error) {
+	if isobject(path) {
+		return new(fileinfo), nil
+	}
+	if filepath.Ext(path) != ".go" {
+		return &fileinfo{header: commentheader(src)}, nil
+	}
+
+	// We use go/parser for convenience.
+	const mode = parser.ImportsOnly | parser.ParseComments
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, mode)
+	if err != nil {
+		return nil, newerror(path, 0, err)
+	}
+	info := &fileinfo{
+		header:  src[:f.Package-1],
+		pkgname: f.Name.Name,
+	}
+	for _, spec := range f.Imports {
+		if spec.Path.Value == `"C"` {
+			info.cgo = true
+		}
+	}
+
+	return info, nil
+}
+
+// commentheader returns the initial run of blank lines, // line comments
+// and /* */ block comments in src.
+func commentheader(src []byte) []byte {
+	i := 0
+	for i < len(src) {
+		rest := src[i:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n':
+			i++
+		case bytes.HasPrefix(rest, []byte("//")):
+			n := bytes.IndexByte(rest, '\n')
+			if n < 0 {
+				return src
+			}
+			i += n + 1
+		case bytes.HasPrefix(rest, []byte("/*")):
+			n := bytes.Index(rest[2:], []byte("*/"))
+			if n < 0 {
+				return src
+			}
+			i += 2 + n + 2
+		default:
+			return src[:i]
+		}
+	}
+
+	return src
+}
+
+// parse returns all the build tags in the named Go file from the package
+// directory dir in fsys.
+func parse(fsys fs.FS, dir, name string) (*File, error) {
+	path := join(fsys, dir, name)
+	if isobject(name) {
+		// Object files are binary, and only the name is used.
+		return parsefile(path, name, nil)
+	}
+	src, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, newerror(path, 0, err)
+	}
+
+	return parsefile(path, name, src)
+}
+
+// parsefile returns all the build tags in the named Go file, with the
+// specified path and content.
+func parsefile(path, name string, src []byte) (*File, error) {
+	file := &File{
+		Name:        name,
+		Tags:        make([]*Tag, 0),
+		Constraints: make([]*Constraint, 0),
+	}
+
+	// Parse the build tags defined in the file name.
+	autotags := parsename(name)
+	pos := Position{File: path, Origin: FileName}
+	if tag := autotags[0]; tag != "" {
+		file.add(tag, pos)
+	}
+	if tag := autotags[1]; tag != "" {
+		file.add(tag, pos)
+	}
+
+	// Parse the build tags in the Go file header.
+	info, err := parseheader(path, src)
+	if err != nil {
+		return nil, err
+	}
+	header := info.header
+	file.Cgo = info.cgo
+	if strings.HasSuffix(name, "_test.go") {
+		file.XTest = strings.HasSuffix(info.pkgname, "_test")
+	} else if filepath.Ext(name) == ".go" {
+		file.BinaryOnly = isBinaryOnly(header)
+	}
+	constraints, err := parseconstraints(path, header)
+	if err != nil {
+		return nil, err
+	}
+	file.Unseparated = unseparated(header, constraints)
+	constraints = without(constraints, file.Unseparated)
+	for _, c := range constraints {
+		pos := Position{File: path, Line: c.Line, Origin: c.Origin}
+		for _, tag := range addtags(nil, c.Expr) {
+			file.add(tag, pos)
+		}
+	}
+	file.Constraints = append(file.Constraints, constraints...)
+	file.Generated = isGenerated(header)
+	file.Misplaced = misplaced(path, header, src)
+
+	return file, nil
+}
+
+// parseconstraints returns all the build constraints in the Go file header.
+// path is the path of the file.
+func parseconstraints(path string, header []byte) ([]*Constraint, error) {
+	list := make([]*Constraint, 0)
+
+	// Try to parse each line of the file header.
+	sc := bufio.NewScanner(bytes.NewReader(header))
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := sc.Text()
+		if !isBuildLine(line) {
+			continue
+		}
+		expr, err := constraint.Parse(line)
+		if err != nil {
+			return nil, newerror(path, lineno, err)
+		}
+
+		c := &Constraint{
+			Expr:   expr,
+			Line:   lineno,
+			Origin: PlusBuild,
+		}
+		if constraint.IsGoBuild(line) {
+			c.Origin = GoBuild
+		}
+		list = append(list, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, newerror(path, 0, fmt.Errorf("internal error: %v", err))
+	}
+
+	return list, nil
+}
+
+// misplaced returns the line numbers of the build constraints after the
+// header in the source src of the named file, that are silently ignored by the
+// go command, like a //go:build line after the package clause.  For Go files,
+// only the // comments after the package clause are considered, so that a
+// build constraint in a string literal is not reported; for the other source
+// files, all the lines after the header are considered.
+func misplaced(path string, header, src []byte) []int {
+	var list []int
+	if filepath.Ext(path) != ".go" {
+		lineno := bytes.Count(header, []byte("\n")) + 1
+		for _, line := range strings.Split(string(src[len(header):]), "\n") {
+			if isBuildLine(strings.TrimSpace(line)) {
+				list = append(list, lineno)
+			}
+			lineno++
+		}
+
+		return list
+	}
+
+	// The body may have syntax errors, not reported by parseheader; the
+	// comments before the error are still available.
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if f == nil {
+		return nil
+	}
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			if c.Slash > f.Package && isBuildLine(c.Text) {
+				list = append(list, fset.Position(c.Slash).Line)
+			}
+		}
+	}
+
+	return list
+}
+
+// unseparated returns the line numbers of the // +build constraints that are
+// not followed by a blank line in the leading run of // comments and blank
+// lines of the header.  Like in go/build, these lines are ignored by the go
+// command, and by the toolchains before Go 1.17 even when the file has a
+// //go:build line.
+func unseparated(header []byte, constraints []*Constraint) []int {
+	blank := 0 // line number of the last blank line in the leading run
+	sc := bufio.NewScanner(bytes.NewReader(header))
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			blank = lineno
+		} else if !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+
+	var list []int
+	for _, c := range constraints {
+		if c.Origin == PlusBuild && c.Line > blank {
+			list = append(list, c.Line)
+		}
+	}
+
+	return list
+}
+
+// without returns the constraints that are not at the specified lines.
+func without(constraints []*Constraint, lines []int) []*Constraint {
+	if len(lines) == 0 {
+		return constraints
+	}
+
+	skip := make(map[int]bool)
+	for _, line := range lines {
+		skip[line] = true
+	}
+	list := make([]*Constraint, 0, len(constraints))
+	for _, c := range constraints {
+		if !skip[c.Line] {
+			list = append(list, c)
+		}
+	}
+
+	return list
+}
+
+// addtags appends all the build tags in expr to tags and returns the extended
+// slice.
+func addtags(tags []string, expr constraint.Expr) []string {
+	switch tag := expr.(type) {
+	case *constraint.AndExpr:
+		tags = addtags(tags, tag.X)
+		tags = addtags(tags, tag.Y)
+	case *constraint.NotExpr:
+		tags = addtags(tags, tag.X)
+	case *constraint.OrExpr:
+		tags = addtags(tags, tag.X)
+		tags = addtags(tags, tag.Y)
+	case *constraint.TagExpr:
+		tags = append(tags, tag.Tag)
+	}
+
+	return tags
+}
+
+// generated matches the comment marking a generated Go file, as defined in
+// https://golang.org/s/generatedcode.
+var generated = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the Go file header marks the file as generated.
+func isGenerated(header []byte) bool {
+	return generated.Match(header)
+}
+
+// binaryOnly matches the comment marking a binary-only package, no longer
+// supported by the go command.
+var binaryOnly = regexp.MustCompile(`(?m)^[ \t]*//go:binary-only-package[ \t\r]*$`)
+
+// isBinaryOnly reports whether the Go file header marks the package as
+// binary-only.
+func isBinaryOnly(header []byte) bool {
+	return binaryOnly.Match(header)
+}
+
+// isIgnored reports whether the named Go file is ignored by the go command.
+func isIgnored(name string) bool {
+	return strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".")
+}
+
+func isBuildLine(line string) bool {
+	if constraint.IsGoBuild(line) || constraint.IsPlusBuild(line) {
+		return true
+	}
+
+	return false
+}
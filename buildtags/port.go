@@ -0,0 +1,279 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/perillo/go-buildtags/internal/invoke"
+)
+
+// Port is a GOOS/GOARCH combination supported by the go command.
+type Port struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (p Port) String() string {
+	return p.GOOS + "/" + p.GOARCH
+}
+
+// Ports is the list of the ports supported by the go command.
+// Taken from the output of go tool dist list in the Go distribution.
+var Ports = []Port{
+	{"aix", "ppc64"},
+	{"android", "386"},
+	{"android", "amd64"},
+	{"android", "arm"},
+	{"android", "arm64"},
+	{"darwin", "amd64"},
+	{"darwin", "arm64"},
+	{"dragonfly", "amd64"},
+	{"freebsd", "386"},
+	{"freebsd", "amd64"},
+	{"freebsd", "arm"},
+	{"freebsd", "arm64"},
+	{"illumos", "amd64"},
+	{"ios", "amd64"},
+	{"ios", "arm64"},
+	{"js", "wasm"},
+	{"linux", "386"},
+	{"linux", "amd64"},
+	{"linux", "arm"},
+	{"linux", "arm64"},
+	{"linux", "loong64"},
+	{"linux", "mips"},
+	{"linux", "mips64"},
+	{"linux", "mips64le"},
+	{"linux", "mipsle"},
+	{"linux", "ppc64"},
+	{"linux", "ppc64le"},
+	{"linux", "riscv64"},
+	{"linux", "s390x"},
+	{"netbsd", "386"},
+	{"netbsd", "amd64"},
+	{"netbsd", "arm"},
+	{"netbsd", "arm64"},
+	{"openbsd", "386"},
+	{"openbsd", "amd64"},
+	{"openbsd", "arm"},
+	{"openbsd", "arm64"},
+	{"openbsd", "mips64"},
+	{"openbsd", "ppc64"},
+	{"openbsd", "riscv64"},
+	{"plan9", "386"},
+	{"plan9", "amd64"},
+	{"plan9", "arm"},
+	{"solaris", "amd64"},
+	{"wasip1", "wasm"},
+	{"windows", "386"},
+	{"windows", "amd64"},
+	{"windows", "arm64"},
+}
+
+// firstClass is the set of the first-class ports, as defined by the Go
+// porting policy: the ports whose failures block the releases.
+var firstClass = map[Port]bool{
+	{"darwin", "amd64"}:  true,
+	{"darwin", "arm64"}:  true,
+	{"linux", "386"}:     true,
+	{"linux", "amd64"}:   true,
+	{"linux", "arm"}:     true,
+	{"linux", "arm64"}:   true,
+	{"windows", "386"}:   true,
+	{"windows", "amd64"}: true,
+}
+
+// FirstClass reports whether p is a first-class port.  The other ports are
+// secondary ports, maintained by the community and not blocking the releases.
+func (p Port) FirstClass() bool {
+	return firstClass[p]
+}
+
+// FirstClassTag reports whether the GOOS or GOARCH build tag is part of a
+// first-class port, like linux or arm64.  Code specific to the other GOOS and
+// GOARCH values is only used by secondary ports.
+func FirstClassTag(tag string) bool {
+	for p := range firstClass {
+		if p.GOOS == tag || p.GOARCH == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removedPorts maps the ports no longer supported by the go command to the Go
+// release that removed them.
+var removedPorts = map[Port]string{
+	{"darwin", "386"}:    "go1.15",
+	{"darwin", "arm"}:    "go1.15",
+	{"nacl", "386"}:      "go1.14",
+	{"nacl", "amd64p32"}: "go1.14",
+	{"nacl", "arm"}:      "go1.14",
+}
+
+// Removed returns the Go release that removed support for p, like go1.15 for
+// darwin/386, or an empty string if p is not a removed port.
+func (p Port) Removed() string {
+	return removedPorts[p]
+}
+
+// RemovedTag returns the Go release that removed support for the GOOS or
+// GOARCH tag, like go1.14 for nacl, or an empty string if the tag is still
+// used by a supported port.
+func RemovedTag(tag string) string {
+	for _, p := range Ports {
+		if p.GOOS == tag || p.GOARCH == tag {
+			return ""
+		}
+	}
+	version := ""
+	for p, v := range removedPorts {
+		if p.GOOS == tag || p.GOARCH == tag {
+			version = v
+		}
+	}
+
+	return version
+}
+
+// RemovedOnly returns the removed ports where file is built, sorted by name,
+// when it is not built on any supported port.  Otherwise it returns nil.  The
+// custom build tags and cgo are assumed to be satisfied as needed.
+func RemovedOnly(file *File) []Port {
+	platform := false
+	for _, tag := range file.Tags {
+		if tag.Category == GOOS || tag.Category == GOARCH {
+			platform = true
+		}
+	}
+	if !platform {
+		return nil
+	}
+
+	base := DefaultContext()
+	base.Tags = nil
+	for _, port := range Ports {
+		if _, ok := satisfy(base, port, file); ok {
+			return nil
+		}
+	}
+	list := make([]Port, 0)
+	for port := range removedPorts {
+		if _, ok := satisfy(base, port, file); ok {
+			list = append(list, port)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+
+	return list
+}
+
+// NameConflict reports whether the GOOS or GOARCH values in the file name
+// contradict the build constraint in the header, like a foo_linux.go file
+// requiring !linux or windows, so that the file is never built although both
+// the name and the constraint can be satisfied on their own.  The custom build
+// tags and cgo are assumed to be satisfied as needed.  The files ignored by
+// the go command are never reported.
+func NameConflict(file *File) bool {
+	goos, goarch := ParseFileName(file.Name)
+	dot := strings.Index(file.Name, ".")
+	if goos == "" && goarch == "" || file.Expr() == nil || dot < 0 || file.Ignored() {
+		return false
+	}
+
+	// The same file, without the GOOS and GOARCH suffix.
+	header := *file
+	header.Name = "file" + file.Name[dot:]
+
+	base := DefaultContext()
+	base.Tags = nil
+	named, constrained := false, false
+	for _, port := range Ports {
+		if _, ok := satisfy(base, port, file); ok {
+			return false
+		}
+		ctx := BuildContext{GOOS: port.GOOS, GOARCH: port.GOARCH}
+		if ctx.matchname(file.Name) {
+			named = true
+		}
+		if _, ok := satisfy(base, port, &header); ok {
+			constrained = true
+		}
+	}
+
+	return named && constrained
+}
+
+// LikePlatform returns the category of the GOOS or GOARCH value the tag is
+// equal to, ignoring the category overrides, or likely to be equal to in a
+// future Go release, like riscv32 or wasip2, that only differ from a known
+// value in the trailing digits.  Otherwise it returns an empty string.
+func LikePlatform(tag string) Category {
+	switch {
+	case knownOS[tag]:
+		return GOOS
+	case knownArch[tag]:
+		return GOARCH
+	}
+	stem := strings.TrimRight(tag, "0123456789")
+	if stem == "" || stem == tag {
+		return ""
+	}
+	for _, known := range []struct {
+		values   map[string]bool
+		category Category
+	}{{knownOS, GOOS}, {knownArch, GOARCH}} {
+		for value := range known.values {
+			if strings.TrimRight(value, "0123456789") == stem {
+				return known.category
+			}
+		}
+	}
+
+	return ""
+}
+
+// DistList returns the ports supported by the installed toolchain, as
+// reported by go tool dist list.
+func DistList(ctx context.Context) ([]Port, error) {
+	cmd := exec.CommandContext(ctx, GoCmd, "tool", "dist", "list")
+	stdout, err := invoke.Output(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Port, 0)
+	for _, line := range strings.Fields(string(stdout)) {
+		i := strings.Index(line, "/")
+		if i < 0 {
+			return nil, fmt.Errorf("dist list: invalid port %q", line)
+		}
+		list = append(list, Port{GOOS: line[:i], GOARCH: line[i+1:]})
+	}
+
+	return list, nil
+}
+
+// UsePorts replaces Ports with the specified ports, like the ones returned by
+// DistList, and adds their GOOS and GOARCH values to the known values, so
+// that the tags and the file name suffixes for new ports are recognized.
+//
+// UsePorts is not safe for concurrent use, and it should be called before
+// scanning any package.
+func UsePorts(ports []Port) {
+	Ports = ports
+	for _, p := range ports {
+		knownOS[p.GOOS] = true
+		knownArch[p.GOARCH] = true
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/perillo/go-buildtags/internal/invoke"
+)
+
+// releaseTag matches a release tag, like go1 or go1.21.
+var releaseTag = regexp.MustCompile(`^go1(\.[1-9][0-9]*)?$`)
+
+// goVersion matches the major and minor version in a Go version, like
+// go1.21.5, go1.22rc1 or devel go1.23-abcdef.
+var goVersion = regexp.MustCompile(`go1\.([1-9][0-9]*)`)
+
+// isReleaseTag reports whether the build tag is a release tag.
+func isReleaseTag(tag string) bool {
+	return releaseTag.MatchString(tag)
+}
+
+// GoVersion returns the version of the toolchain of the go command, as
+// reported by go env GOVERSION, like go1.21.5.
+func GoVersion(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, GoCmd, "env", "GOVERSION")
+	stdout, err := invoke.Output(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	return string(stdout), nil
+}
+
+// ReleaseTags returns the release tags satisfied by the Go version, like
+// go1, go1.1 up to go1.21 for go1.21.5.  It returns nil if the version is not
+// valid.
+func ReleaseTags(version string) []string {
+	m := goVersion.FindStringSubmatch(version)
+	if m == nil {
+		return nil
+	}
+	minor, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil
+	}
+
+	tags := []string{"go1"}
+	for i := 1; i <= minor; i++ {
+		tags = append(tags, "go1."+strconv.Itoa(i))
+	}
+
+	return tags
+}
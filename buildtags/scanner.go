@@ -0,0 +1,424 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// defaultScanner is the Scanner used by Scan and the related functions.
+var defaultScanner = NewScanner()
+
+// Scanner scans the build tags in Go packages.  A Scanner is configured using
+// options when it is created, and it is safe for concurrent use.
+type Scanner struct {
+	tests      bool                // scan _test.go files
+	onlytests  bool                // scan only _test.go files
+	ignored    bool                // scan files ignored by the go command
+	generated  bool                // scan generated files
+	symlinks   bool                // follow symbolic links to Go files
+	pattern    string              // scan only the files matching the pattern, if not empty
+	keep       func(string) bool   // scan only the files for which keep returns true, if not nil
+	categories map[Category]bool   // report only tags in these categories, if not nil
+	overrides  map[string]Category // category of tags, overriding Categorize
+	workers    int                 // maximum number of files parsed concurrently
+	overlay    *overlayFS          // files replaced by an overlay, if not nil
+}
+
+// Option configures a Scanner.
+type Option func(*Scanner)
+
+// WithTestFiles configures whether the scanner should scan the _test.go
+// files.  By default, test files are scanned.
+func WithTestFiles(scan bool) Option {
+	return func(s *Scanner) {
+		s.tests = scan
+		s.onlytests = false
+	}
+}
+
+// WithOnlyTestFiles configures the scanner to only scan the _test.go files,
+// so that the tags used only for testing can be inspected.
+func WithOnlyTestFiles() Option {
+	return func(s *Scanner) {
+		s.tests = true
+		s.onlytests = true
+	}
+}
+
+// WithIgnoredFiles configures whether the scanner should scan the Go files
+// ignored by the go command, whose name starts with "_" or ".".  By default,
+// ignored files are scanned.
+func WithIgnoredFiles(scan bool) Option {
+	return func(s *Scanner) {
+		s.ignored = scan
+	}
+}
+
+// WithGeneratedFiles configures whether the scanner should report the
+// generated Go files, having a "// Code generated ... DO NOT EDIT." line in
+// the header.  By default, generated files are reported.
+func WithGeneratedFiles(scan bool) Option {
+	return func(s *Scanner) {
+		s.generated = scan
+	}
+}
+
+// WithSymlinks configures whether the scanner should follow the symbolic links
+// to Go files in the package directories, as used by build layouts linking
+// generated or shared sources into packages.  Broken links are ignored.  By
+// default, symbolic links are not followed, and the linked files are not
+// scanned.
+func WithSymlinks(follow bool) Option {
+	return func(s *Scanner) {
+		s.symlinks = follow
+	}
+}
+
+// WithOverlay configures the scanner to replace the contents of the files
+// read from the operating system, as specified by the Replace field of the
+// go command -overlay file.  The replace map has the paths of the replaced
+// files as keys, absolute or relative to the current directory, and the
+// paths of the replacement files as values; an empty value deletes the file.
+// The overlay is not used by ScanFS.
+func WithOverlay(replace map[string]string) Option {
+	return func(s *Scanner) {
+		s.overlay = newoverlay(replace)
+	}
+}
+
+// WithFilePattern configures the scanner to only scan the Go files whose name
+// matches the pattern, using the path.Match syntax, like in net_*.go.  A
+// malformed pattern matches no files.  By default, all the Go files are
+// scanned.
+func WithFilePattern(pattern string) Option {
+	return func(s *Scanner) {
+		s.pattern = pattern
+	}
+}
+
+// WithFileFilter configures the scanner to only scan the files whose path,
+// the package directory joined with the file name, satisfies keep.  The other
+// files are never read, so a malformed file can be skipped.  By default, all
+// the files are scanned.
+func WithFileFilter(keep func(path string) bool) Option {
+	return func(s *Scanner) {
+		s.keep = keep
+	}
+}
+
+// WithCategories configures the scanner to only report the build tags in the
+// specified categories.  The constraints of each file are not affected.  By
+// default, tags in all categories are reported.
+func WithCategories(categories ...Category) Option {
+	return func(s *Scanner) {
+		s.categories = make(map[Category]bool)
+		for _, c := range categories {
+			s.categories[c] = true
+		}
+	}
+}
+
+// WithTagCategories configures the scanner to assign the specified category
+// to the named tags, overriding the category returned by Categorize.  This can
+// be used for custom tags having a special meaning in a project.  The
+// overrides are applied before the categories filter.
+func WithTagCategories(categories map[string]Category) Option {
+	return func(s *Scanner) {
+		s.overrides = make(map[string]Category)
+		for tag, c := range categories {
+			s.overrides[tag] = c
+		}
+	}
+}
+
+// WithConcurrency configures the maximum number of files the scanner parses
+// concurrently.  Values less than 1 are treated as 1.  By default, files are
+// parsed sequentially.
+//
+// Even with concurrency enabled, files are reported in the same order as a
+// sequential scan, and the function passed to ScanFunc is never called
+// concurrently.
+func WithConcurrency(n int) Option {
+	return func(s *Scanner) {
+		if n < 1 {
+			n = 1
+		}
+		s.workers = n
+	}
+}
+
+// NewScanner returns a new Scanner configured with the specified options.
+func NewScanner(opts ...Option) *Scanner {
+	s := &Scanner{
+		tests:     true,
+		ignored:   true,
+		generated: true,
+		workers:   1,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Scan parses the build tags in all the Go files in the specified package
+// directories.
+//
+// The provided context is checked before reading each package directory and
+// before parsing each file.  If the context is done, Scan returns the context
+// error.
+func (s *Scanner) Scan(ctx context.Context, dirs []string) (*Report, error) {
+	return s.ScanPackages(ctx, newpackages(dirs))
+}
+
+// ScanPackages parses the build tags in all the Go files in the directory of
+// each package, setting the package Files field.
+func (s *Scanner) ScanPackages(ctx context.Context, packages []*Package) (*Report, error) {
+	return s.scan(ctx, s.osfs(), packages)
+}
+
+// ScanFS is like Scan, but the package directories are read from fsys.  The
+// directories must be valid paths, as defined by fs.ValidPath.
+func (s *Scanner) ScanFS(ctx context.Context, fsys fs.FS, dirs []string) (*Report, error) {
+	for _, dir := range dirs {
+		if !fs.ValidPath(dir) {
+			return nil, &fs.PathError{Op: "scan", Path: dir, Err: fs.ErrInvalid}
+		}
+	}
+
+	return s.scan(ctx, fsys, newpackages(dirs))
+}
+
+// ScanFunc is like Scan, but instead of returning a report it calls fn for
+// each Go file in the specified package directories, as soon as the file has
+// been scanned.  The Files field of the reported package is not set.
+//
+// If fn returns an error, ScanFunc stops and returns that error.
+func (s *Scanner) ScanFunc(ctx context.Context, dirs []string, fn func(FileTags) error) error {
+	return s.ScanPackagesFunc(ctx, newpackages(dirs), fn)
+}
+
+// ScanPackagesFunc is like ScanFunc, but for the specified packages.
+func (s *Scanner) ScanPackagesFunc(ctx context.Context, packages []*Package, fn func(FileTags) error) error {
+	return s.walk(ctx, s.osfs(), packages, fn)
+}
+
+// osfs returns the file system used to read the operating system files,
+// with the overlay applied.
+func (s *Scanner) osfs() fs.FS {
+	if s.overlay != nil {
+		return s.overlay
+	}
+
+	return osFS{}
+}
+
+// scan implements ScanPackages and ScanFS.
+func (s *Scanner) scan(ctx context.Context, fsys fs.FS, packages []*Package) (*Report, error) {
+	for _, pkg := range packages {
+		pkg.Files = make([]*File, 0)
+	}
+	err := s.walk(ctx, fsys, packages, func(ft FileTags) error {
+		ft.Package.Files = append(ft.Package.Files, ft.File)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Report{Packages: packages}, nil
+}
+
+// walk scans all the Go files in the directory of each package from fsys,
+// calling fn for each file.
+func (s *Scanner) walk(ctx context.Context, fsys fs.FS, packages []*Package, fn func(FileTags) error) error {
+	if s.workers > 1 {
+		return s.pwalk(ctx, fsys, packages, fn)
+	}
+
+	for _, pkg := range packages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		gofiles, err := readdir(fsys, pkg.Dir, s.symlinks)
+		if err != nil {
+			return err
+		}
+		for _, name := range gofiles {
+			if !s.match(fsys, pkg.Dir, name) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			file, err := parse(fsys, pkg.Dir, name)
+			if err != nil {
+				return err
+			}
+			if !s.generated && file.Generated {
+				continue
+			}
+			s.filter(file)
+			if err := fn(FileTags{Package: pkg, File: file}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// job is a Go file to be parsed by a pwalk worker.
+type job struct {
+	pkg  *Package
+	name string
+	done chan result // receives the result, buffered
+}
+
+// result is the result of a job.
+type result struct {
+	file *File
+	err  error
+}
+
+// pwalk is like walk, but parses the Go files concurrently using a pool of
+// s.workers goroutines.
+//
+// Jobs are queued in order, so that the results can be reported in the same
+// order as walk, without waiting for all the files to be parsed.
+func (s *Scanner) pwalk(ctx context.Context, fsys fs.FS, packages []*Package, fn func(FileTags) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *job)
+	queue := make(chan *job, s.workers)
+
+	// Start the workers.
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for j := range jobs {
+				file, err := parse(fsys, j.pkg.Dir, j.name)
+				if err == nil {
+					s.filter(file)
+				}
+				j.done <- result{file, err}
+			}
+		}()
+	}
+
+	// Queue the jobs.
+	go func() {
+		defer close(jobs)
+		defer close(queue)
+
+		for _, pkg := range packages {
+			gofiles, err := readdir(fsys, pkg.Dir, s.symlinks)
+			if err != nil {
+				j := &job{pkg: pkg, done: make(chan result, 1)}
+				j.done <- result{err: err}
+				select {
+				case queue <- j:
+				case <-ctx.Done():
+				}
+
+				return
+			}
+
+			for _, name := range gofiles {
+				if !s.match(fsys, pkg.Dir, name) {
+					continue
+				}
+				j := &job{pkg: pkg, name: name, done: make(chan result, 1)}
+				select {
+				case queue <- j:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case jobs <- j:
+				case <-ctx.Done():
+					j.done <- result{err: ctx.Err()}
+
+					return
+				}
+			}
+		}
+	}()
+
+	// Report the results in order.
+	for j := range queue {
+		r := <-j.done
+		if r.err != nil {
+			return r.err
+		}
+		if !s.generated && r.file.Generated {
+			continue
+		}
+		if err := fn(FileTags{Package: j.pkg, File: r.file}); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// match reports whether the named Go file in the package directory dir in
+// fsys should be scanned.
+func (s *Scanner) match(fsys fs.FS, dir, name string) bool {
+	test := strings.HasSuffix(name, "_test.go")
+	if !s.tests && test || s.onlytests && !test {
+		return false
+	}
+	if !s.ignored && isIgnored(name) {
+		return false
+	}
+	if s.pattern != "" {
+		if ok, _ := path.Match(s.pattern, name); !ok {
+			return false
+		}
+	}
+	if s.keep != nil && !s.keep(join(fsys, dir, name)) {
+		return false
+	}
+
+	return true
+}
+
+// filter overrides the category of the tags in file and removes the tags in
+// the categories not reported by s.
+func (s *Scanner) filter(file *File) {
+	for _, tag := range file.Tags {
+		if c, ok := s.overrides[tag.Name]; ok {
+			tag.Category = c
+		}
+	}
+	if s.categories == nil {
+		return
+	}
+
+	tags := file.Tags[:0]
+	for _, tag := range file.Tags {
+		if s.categories[tag.Category] {
+			tags = append(tags, tag)
+		}
+	}
+	file.Tags = tags
+}
+
+// newpackages returns a new package for each directory.
+func newpackages(dirs []string) []*Package {
+	packages := make([]*Package, 0, len(dirs))
+	for _, dir := range dirs {
+		packages = append(packages, &Package{Dir: dir})
+	}
+
+	return packages
+}
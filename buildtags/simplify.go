@@ -0,0 +1,198 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"go/build/constraint"
+)
+
+// Simplify returns a simpler expression equivalent to the build constraint
+// expr, or expr itself if no simplification applies.  Simplify removes double
+// negations, duplicate operands and operands absorbed by other ones, like in
+// linux || (linux && amd64), the GOOS values implied by another one, like
+// android in linux || android, and replaces the disjunction of all the Unix
+// GOOS values with unix.
+func Simplify(expr constraint.Expr) constraint.Expr {
+	for {
+		x := simplify(expr)
+		if x.String() == expr.String() {
+			return expr
+		}
+		expr = x
+	}
+}
+
+// simplify applies a single pass of simplifications to expr.
+func simplify(expr constraint.Expr) constraint.Expr {
+	switch x := expr.(type) {
+	case *constraint.NotExpr:
+		y := simplify(x.X)
+		if z, ok := y.(*constraint.NotExpr); ok {
+			return z.X
+		}
+
+		return &constraint.NotExpr{X: y}
+	case *constraint.AndExpr:
+		terms := absorb(operands(x, false), false)
+
+		return combine(terms, false)
+	case *constraint.OrExpr:
+		terms := absorb(operands(x, true), true)
+		terms = unixterms(impliedterms(terms))
+
+		return combine(terms, true)
+	}
+
+	return expr
+}
+
+// operands returns the simplified operands of the chain of conjunctions, or
+// of disjunctions if or is true, expr.
+func operands(expr constraint.Expr, or bool) []constraint.Expr {
+	terms := flatten(expr, or, nil)
+	for i, t := range terms {
+		terms[i] = simplify(t)
+	}
+
+	return terms
+}
+
+// flatten appends to list the operands of the chain of conjunctions, or of
+// disjunctions if or is true, expr, and returns the extended list.
+func flatten(expr constraint.Expr, or bool, list []constraint.Expr) []constraint.Expr {
+	switch x := expr.(type) {
+	case *constraint.AndExpr:
+		if !or {
+			list = flatten(x.X, or, list)
+
+			return flatten(x.Y, or, list)
+		}
+	case *constraint.OrExpr:
+		if or {
+			list = flatten(x.X, or, list)
+
+			return flatten(x.Y, or, list)
+		}
+	}
+
+	return append(list, expr)
+}
+
+// absorb returns the terms of a conjunction, or of a disjunction if or is
+// true, without the duplicate terms and the terms absorbed by another one, as
+// in a || (a && b) and a && (a || b).
+func absorb(terms []constraint.Expr, or bool) []constraint.Expr {
+	list := make([]constraint.Expr, 0, len(terms))
+	added := make(map[string]bool)
+	for _, t := range terms {
+		s := t.String()
+		if added[s] || absorbed(t, terms, or) {
+			continue
+		}
+		added[s] = true
+		list = append(list, t)
+	}
+
+	return list
+}
+
+// absorbed reports whether the term t of a conjunction, or of a disjunction if
+// or is true, is absorbed by another term in terms, whose operands are a
+// proper subset of the ones of t, like a in a || (a && b) or a || b in
+// (a || b) && (a || b || c).
+func absorbed(t constraint.Expr, terms []constraint.Expr, or bool) bool {
+	inner := make(map[string]bool)
+	for _, x := range flatten(t, !or, nil) {
+		inner[x.String()] = true
+	}
+	for _, u := range terms {
+		other := flatten(u, !or, nil)
+		if len(other) >= len(inner) {
+			continue
+		}
+		subset := true
+		for _, x := range other {
+			if !inner[x.String()] {
+				subset = false
+			}
+		}
+		if subset {
+			return true
+		}
+	}
+
+	return false
+}
+
+// impliedterms returns the terms of a disjunction without the GOOS values
+// implied by another term, like android when linux is a term.
+func impliedterms(terms []constraint.Expr) []constraint.Expr {
+	tags := make(map[string]bool)
+	for _, t := range terms {
+		if x, ok := t.(*constraint.TagExpr); ok {
+			tags[x.Tag] = true
+		}
+	}
+
+	list := make([]constraint.Expr, 0, len(terms))
+	for _, t := range terms {
+		if x, ok := t.(*constraint.TagExpr); ok {
+			if tags[impliedOS[x.Tag]] || unixOS[x.Tag] && tags["unix"] {
+				continue
+			}
+		}
+		list = append(list, t)
+	}
+
+	return list
+}
+
+// unixterms returns the terms of a disjunction, with the GOOS values
+// satisfying the unix build tag replaced by unix, when all of them are terms
+// or implied by a term.
+func unixterms(terms []constraint.Expr) []constraint.Expr {
+	tags := make(map[string]bool)
+	for _, t := range terms {
+		if x, ok := t.(*constraint.TagExpr); ok {
+			tags[x.Tag] = true
+		}
+	}
+	for goos := range unixOS {
+		if !tags[goos] && !tags[impliedOS[goos]] {
+			return terms
+		}
+	}
+
+	list := make([]constraint.Expr, 0, len(terms))
+	replaced := false
+	for _, t := range terms {
+		if x, ok := t.(*constraint.TagExpr); ok && unixOS[x.Tag] {
+			if !replaced {
+				list = append(list, &constraint.TagExpr{Tag: "unix"})
+				replaced = true
+			}
+
+			continue
+		}
+		list = append(list, t)
+	}
+
+	return list
+}
+
+// combine returns the conjunction, or the disjunction if or is true, of the
+// terms.
+func combine(terms []constraint.Expr, or bool) constraint.Expr {
+	x := terms[0]
+	for _, y := range terms[1:] {
+		if or {
+			x = &constraint.OrExpr{X: x, Y: y}
+		} else {
+			x = &constraint.AndExpr{X: x, Y: y}
+		}
+	}
+
+	return x
+}
@@ -0,0 +1,155 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"go/build/constraint"
+	"sort"
+)
+
+// Stats contains aggregate metrics about the build tags in a report, useful
+// to track the build tag complexity of a project over time.
+type Stats struct {
+	Packages      int // number of packages
+	Files         int // number of Go files
+	Constrained   int // number of files with a file name or header constraint
+	Unconstrained int // number of files without constraints
+
+	// TagsPerPackage maps the number of distinct build tags in a package to
+	// the number of packages with that many tags.
+	TagsPerPackage map[int]int
+
+	CustomTags []*TagCount  // custom build tags, most used first
+	Deepest    []*ExprDepth // constraints with the deepest expressions first
+}
+
+// TagCount is the number of files using a build tag.
+type TagCount struct {
+	Name  string
+	Files int
+}
+
+// ExprDepth is the nesting depth of a build constraint expression.  The depth
+// of a single tag is 0; each change of operator, like in (a || b) && c,
+// increments the depth by one.
+type ExprDepth struct {
+	Package    *Package
+	File       *File
+	Constraint *Constraint
+	Depth      int
+}
+
+// Stats returns the aggregate metrics for the report.  At most n of the
+// deepest constraint expressions are returned; n < 0 means all.
+func (r *Report) Stats(n int) *Stats {
+	stats := &Stats{
+		TagsPerPackage: make(map[int]int),
+		CustomTags:     make([]*TagCount, 0),
+		Deepest:        make([]*ExprDepth, 0),
+	}
+	custom := make(map[string]int)
+	for _, pkg := range r.Packages {
+		stats.Packages++
+		tags := make(map[string]bool)
+		for _, file := range pkg.Files {
+			stats.Files++
+			if len(file.Tags) > 0 {
+				stats.Constrained++
+			} else {
+				stats.Unconstrained++
+			}
+			for _, tag := range file.Tags {
+				tags[tag.Name] = true
+				if tag.Category == BuildTag {
+					custom[tag.Name]++
+				}
+			}
+			for _, c := range file.Constraints {
+				stats.Deepest = append(stats.Deepest, &ExprDepth{
+					Package:    pkg,
+					File:       file,
+					Constraint: c,
+					Depth:      depth(c.Expr),
+				})
+			}
+		}
+		stats.TagsPerPackage[len(tags)]++
+	}
+
+	for name, count := range custom {
+		stats.CustomTags = append(stats.CustomTags, &TagCount{Name: name, Files: count})
+	}
+	sort.Slice(stats.CustomTags, func(i, j int) bool {
+		a, b := stats.CustomTags[i], stats.CustomTags[j]
+		if a.Files != b.Files {
+			return a.Files > b.Files
+		}
+
+		return a.Name < b.Name
+	})
+
+	// The stable sort preserves the order of the files for equal depths.
+	sort.SliceStable(stats.Deepest, func(i, j int) bool {
+		return stats.Deepest[i].Depth > stats.Deepest[j].Depth
+	})
+	if n >= 0 && len(stats.Deepest) > n {
+		stats.Deepest = stats.Deepest[:n]
+	}
+
+	return stats
+}
+
+// depth returns the nesting depth of expr.
+func depth(expr constraint.Expr) int {
+	switch x := expr.(type) {
+	case *constraint.AndExpr:
+		return opdepth(x, x.X, x.Y)
+	case *constraint.OrExpr:
+		return opdepth(x, x.X, x.Y)
+	case *constraint.NotExpr:
+		if _, ok := x.X.(*constraint.TagExpr); ok {
+			return 1
+		}
+
+		return depth(x.X) + 1
+	}
+
+	return 0
+}
+
+// opdepth returns the nesting depth of the binary expression op with operands
+// x and y.  Operands using the same operator as op, like in a && b && c, do
+// not increment the depth.
+func opdepth(op, x, y constraint.Expr) int {
+	d := 0
+	for _, operand := range []constraint.Expr{x, y} {
+		n := depth(operand) + 1
+		if sameop(op, operand) {
+			n--
+		}
+		if n > d {
+			d = n
+		}
+	}
+
+	return d
+}
+
+// sameop reports whether x and y are binary expressions with the same
+// operator.
+func sameop(x, y constraint.Expr) bool {
+	switch x.(type) {
+	case *constraint.AndExpr:
+		_, ok := y.(*constraint.AndExpr)
+
+		return ok
+	case *constraint.OrExpr:
+		_, ok := y.(*constraint.OrExpr)
+
+		return ok
+	}
+
+	return false
+}
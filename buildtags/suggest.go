@@ -0,0 +1,87 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"sort"
+)
+
+// Suggest returns the known tag, like a GOOS or GOARCH value, that the custom
+// build tag is probably a misspelling of, like linux for linx, or an empty
+// string if there is none.  Tags shorter than 4 characters are never
+// considered misspelled, since they are too close to each other.
+func Suggest(tag string) string {
+	if len(tag) < 4 || Categorize(tag) != BuildTag {
+		return ""
+	}
+	max := 1
+	if len(tag) > 4 {
+		max = 2
+	}
+
+	best, dist := "", max+1
+	for _, known := range suggestions() {
+		if d := distance(tag, known); d < dist {
+			best, dist = known, d
+		}
+	}
+
+	return best
+}
+
+// suggestions returns the known tags a custom tag is compared to, in sorted
+// order, so that Suggest is deterministic.
+func suggestions() []string {
+	list := make([]string, 0)
+	for _, m := range []map[string]bool{knownOS, knownArch, knownCompiler, knownSpecialTag, knownStdlib, knownConvention, knownFuzz} {
+		for tag := range m {
+			list = append(list, tag)
+		}
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// distance returns the edit distance between a and b, counting the
+// insertion, deletion and substitution of a byte and the transposition of two
+// adjacent bytes as a single edit.
+func distance(a, b string) int {
+	// d[i][j] is the distance between a[:i] and b[:j].
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = smallest(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = smallest(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
+
+// smallest returns the smallest of the values.
+func smallest(values ...int) int {
+	v := values[0]
+	for _, x := range values[1:] {
+		if x < v {
+			v = x
+		}
+	}
+
+	return v
+}
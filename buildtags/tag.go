@@ -0,0 +1,256 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildtags
+
+import (
+	"encoding/json"
+	"go/build/constraint"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Origin is the kind of source where a build tag has been specified.
+type Origin string
+
+// Build tag origins.
+const (
+	FileName  Origin = "filename" // the Go file name, like in file_linux.go
+	GoBuild   Origin = "go:build" // a //go:build line
+	PlusBuild Origin = "+build"   // a // +build line
+)
+
+// Position describes where a build tag has been specified.
+type Position struct {
+	File   string // path of the file
+	Line   int    // line number, starting at 1, or 0 for the file name
+	Origin Origin // kind of source
+}
+
+// Tag describes a build tag and where it has been specified.
+type Tag struct {
+	Name      string     // tag name
+	Category  Category   // tag category
+	Positions []Position // where the tag has been specified, one entry for each occurrence
+	TestOnly  bool       `json:",omitempty"` // tag specified only in _test.go files
+}
+
+// Constraint describes a build constraint line in a Go file header.
+type Constraint struct {
+	Expr   constraint.Expr // parsed expression
+	Line   int             // line number, starting at 1
+	Origin Origin          // GoBuild or PlusBuild
+}
+
+// MarshalJSON implements the json.Marshaler interface.  The expression is
+// encoded as a string, using the //go:build syntax.
+func (c *Constraint) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Expr   string
+		Line   int
+		Origin Origin
+	}{
+		Expr:   c.Expr.String(),
+		Line:   c.Line,
+		Origin: c.Origin,
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.  The expression
+// is decoded from a string, using the //go:build syntax.
+func (c *Constraint) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Expr   string
+		Line   int
+		Origin Origin
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	expr, err := constraint.Parse("//go:build " + v.Expr)
+	if err != nil {
+		return err
+	}
+	c.Expr = expr
+	c.Line = v.Line
+	c.Origin = v.Origin
+
+	return nil
+}
+
+// Expr returns the build constraint in effect for the file header, as
+// computed by the go command: the //go:build line if present, otherwise the
+// conjunction of all the // +build lines.  Constraints implied by the file
+// name are not included.
+//
+// Expr returns nil if the file header has no build constraints.
+func (f *File) Expr() constraint.Expr {
+	var expr constraint.Expr
+	for _, c := range f.Constraints {
+		if c.Origin == GoBuild {
+			return c.Expr
+		}
+		if expr == nil {
+			expr = c.Expr
+		} else {
+			expr = &constraint.AndExpr{X: expr, Y: c.Expr}
+		}
+	}
+
+	return expr
+}
+
+// Ignored reports whether the file is ignored by the go command, since its
+// name starts with "_" or ".".
+func (f *File) Ignored() bool {
+	return isIgnored(f.Name)
+}
+
+// FileKind is the kind of a file, matching the classification of the
+// go/build package.
+type FileKind string
+
+// File kinds.
+const (
+	GoFiles      FileKind = "GoFiles"      // Go files, except cgo and test files
+	CgoFiles     FileKind = "CgoFiles"     // Go files importing "C"
+	TestGoFiles  FileKind = "TestGoFiles"  // _test.go files in the package
+	XTestGoFiles FileKind = "XTestGoFiles" // _test.go files outside the package
+	CFiles       FileKind = "CFiles"       // .c files
+	CXXFiles     FileKind = "CXXFiles"     // .cc, .cpp and .cxx files
+	MFiles       FileKind = "MFiles"       // .m files
+	HFiles       FileKind = "HFiles"       // .h, .hh, .hpp and .hxx files
+	FFiles       FileKind = "FFiles"       // .f, .F, .for and .f90 files
+	SFiles       FileKind = "SFiles"       // .s, .S and .sx files
+	SwigFiles    FileKind = "SwigFiles"    // .swig files
+	SwigCXXFiles FileKind = "SwigCXXFiles" // .swigcxx files
+	SysoFiles    FileKind = "SysoFiles"    // .syso object files
+)
+
+// FileKinds is the list of all the file kinds, in the order they are
+// reported.
+var FileKinds = []FileKind{
+	GoFiles, CgoFiles, TestGoFiles, XTestGoFiles,
+	CFiles, CXXFiles, MFiles, HFiles, FFiles, SFiles,
+	SwigFiles, SwigCXXFiles, SysoFiles,
+}
+
+// Kind returns the kind of the file.  Like the go/build package, a test file
+// importing "C" is a test file.
+func (f *File) Kind() FileKind {
+	switch {
+	case strings.HasSuffix(f.Name, "_test.go") && f.XTest:
+		return XTestGoFiles
+	case strings.HasSuffix(f.Name, "_test.go"):
+		return TestGoFiles
+	case f.Cgo:
+		return CgoFiles
+	case path.Ext(f.Name) == ".go":
+		return GoFiles
+	}
+
+	return extKinds[path.Ext(f.Name)]
+}
+
+// Standalone reports whether the file is a standalone program, like a code
+// generator or an example, excluded from the package by the conventional
+// //go:build ignore constraint.
+func (f *File) Standalone() bool {
+	x, ok := f.Expr().(*constraint.TagExpr)
+
+	return ok && x.Tag == "ignore"
+}
+
+// Header reports whether the file is a C or C++ header file, like file.h,
+// that is included by the other cgo sources instead of being compiled on its
+// own.
+func (f *File) Header() bool {
+	return isheader(f.Name)
+}
+
+// add records an occurrence at pos of the named tag in the file.
+func (f *File) add(name string, pos Position) {
+	for _, tag := range f.Tags {
+		if tag.Name == name {
+			tag.Positions = append(tag.Positions, pos)
+
+			return
+		}
+	}
+
+	tag := &Tag{
+		Name:      name,
+		Category:  Categorize(name),
+		Positions: []Position{pos},
+		TestOnly:  strings.HasSuffix(f.Name, "_test.go"),
+	}
+	f.Tags = append(f.Tags, tag)
+}
+
+// Tags returns all the build tags specified in the report, sorted by category,
+// in the order defined by Categories, and then by name.
+func (r *Report) Tags() []*Tag {
+	index := make(map[string]*Tag)
+	list := make([]*Tag, 0)
+	for _, pkg := range r.Packages {
+		for _, file := range pkg.Files {
+			for _, tag := range file.Tags {
+				t, ok := index[tag.Name]
+				if !ok {
+					t = &Tag{
+						Name:      tag.Name,
+						Category:  tag.Category,
+						Positions: make([]Position, 0, len(tag.Positions)),
+						TestOnly:  true,
+					}
+					index[tag.Name] = t
+					list = append(list, t)
+				}
+				t.Positions = append(t.Positions, tag.Positions...)
+				t.TestOnly = t.TestOnly && tag.TestOnly
+			}
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		ci, cj := order(list[i].Category), order(list[j].Category)
+		if ci != cj {
+			return ci < cj
+		}
+
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// Count returns the number of times each build tag has been specified in the
+// report.
+func (r *Report) Count() map[string]int {
+	count := make(map[string]int)
+	for _, pkg := range r.Packages {
+		for _, file := range pkg.Files {
+			for _, tag := range file.Tags {
+				count[tag.Name] += len(tag.Positions)
+			}
+		}
+	}
+
+	return count
+}
+
+// order returns the index of the category c in Categories.  Unknown categories
+// are ordered last.
+func order(c Category) int {
+	for i, v := range Categories {
+		if v == c {
+			return i
+		}
+	}
+
+	return len(Categories)
+}
@@ -0,0 +1,7 @@
+// Copyright notice.
+
+//go:build (custom || cgo) && !go1.17
+// +build custom cgo
+// +build !go1.17
+
+package basic
@@ -0,0 +1,2 @@
+// Package basic is a test package.
+package basic
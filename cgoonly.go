@@ -0,0 +1,87 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// Reasons a file is only built when cgo is enabled.
+const (
+	cgoImport = "import \"C\"" // Go file importing "C"
+	cgoTag    = "cgo tag"      // constraint requiring the cgo tag
+	cgoSource = "cgo source"   // C, C++, Objective-C, Fortran or SWIG source
+)
+
+// cgoonlypkg is a package with files only built when cgo is enabled.
+type cgoonlypkg struct {
+	Package string         // import path, or directory if not known
+	Files   []*cgoonlyfile // files only built with cgo
+}
+
+// cgoonlyfile is a file only built when cgo is enabled.
+type cgoonlyfile struct {
+	File   string // file path
+	Reason string // import "C", cgo tag or cgo source
+}
+
+// cgoonlyfiles returns, for each package in the report, the files only built
+// when cgo is enabled, so that it is easy to gauge what is lost with
+// CGO_ENABLED=0.  The packages without such files are not reported.
+func cgoonlyfiles(report *buildtags.Report) []*cgoonlypkg {
+	match := func(file *buildtags.File) bool {
+		return cgoonly(file) != ""
+	}
+
+	list := make([]*cgoonlypkg, 0)
+	for _, p := range filesbypkg(report, match) {
+		files := make([]*cgoonlyfile, 0, len(p.Files))
+		for _, file := range p.Files {
+			files = append(files, &cgoonlyfile{File: render(p.Package, file.Name), Reason: cgoonly(file)})
+		}
+		list = append(list, &cgoonlypkg{Package: p.Name, Files: files})
+	}
+
+	return list
+}
+
+// cgoonly returns the reason file is only built when cgo is enabled, or an
+// empty string if it is also built without cgo.  Header files are not
+// reported, since they are not compiled on their own.
+func cgoonly(file *buildtags.File) string {
+	switch file.Kind() {
+	case buildtags.CFiles, buildtags.CXXFiles, buildtags.MFiles, buildtags.FFiles,
+		buildtags.SwigFiles, buildtags.SwigCXXFiles:
+		return cgoSource
+	}
+	if file.Cgo {
+		return cgoImport
+	}
+	if x := effective(file); x != nil && unsatisfiable(x, map[string]bool{"cgo": false}) {
+		return cgoTag
+	}
+
+	return ""
+}
+
+// printcgoonly writes to w, for each package, the number of files only built
+// when cgo is enabled followed by the files, with the reason.
+func printcgoonly(w io.Writer, pkgs []*cgoonlypkg) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "cgo-only:")
+	for _, p := range pkgs {
+		fmt.Fprintf(tw, "\t%s\t%s\n", p.Package, strconv.Itoa(len(p.Files)))
+		for _, f := range p.Files {
+			fmt.Fprintf(tw, "\t\t%s\t%s\n", f.File, f.Reason)
+		}
+	}
+
+	return tw.Flush()
+}
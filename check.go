@@ -0,0 +1,592 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build/constraint"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var checkCmd = &command{
+	name:  "check",
+	args:  "[packages]",
+	short: "check that the build tags in the packages conform to the policies",
+	flags: checkFlags,
+	run:   runCheck,
+}
+
+// check command flags.
+var (
+	checkFlags  = flag.NewFlagSet("check", flag.ExitOnError)
+	nocustom    = checkFlags.Bool("no-custom", false, "disallow custom build tags")
+	noplusbuild = checkFlags.Bool("no-plus-build", false, "disallow legacy // +build lines")
+	only        = checkFlags.String("only", "", "comma separated list of the only allowed tags")
+	allow       = checkFlags.String("allow", "", "comma separated list of the allowed custom tags; other custom tags are disallowed")
+	deny        = checkFlags.String("deny", "", "comma separated list of the denied tags")
+	failon      = checkFlags.String("fail-on", "", "comma separated list of the finding `kinds` causing a non-zero exit status (default all)")
+	baseline    = checkFlags.String("baseline", "", "only report the tags not recorded in the baseline `file`")
+)
+
+// Finding kinds.
+const (
+	findCustomTag  = "custom-tag"
+	findPlusBuild  = "legacy-build-line"
+	findDisallowed = "disallowed-tag"
+	findDenied     = "denied-tag"
+	findNewTag     = "new-tag"
+	findTypo       = "misspelled-tag"
+	findFuture     = "future-release-tag"
+	findRemoved    = "removed-platform"
+	findPlatform   = "platform-tag"
+	findMismatch   = "build-line-mismatch"
+	findMisplaced  = "misplaced-constraint"
+	findNoBlank    = "missing-blank-line"
+	findConflict   = "name-conflict"
+	findRedundant  = "redundant-constraint"
+)
+
+// kinds is the list of all the finding kinds.
+var kinds = []string{
+	findCustomTag,
+	findPlusBuild,
+	findDisallowed,
+	findDenied,
+	findNewTag,
+	findTypo,
+	findFuture,
+	findRemoved,
+	findPlatform,
+	findMismatch,
+	findMisplaced,
+	findNoBlank,
+	findConflict,
+	findRedundant,
+}
+
+// warnings is the set of the finding kinds that are only warnings, not
+// causing a non-zero exit status unless specified by the -fail-on flag.
+var warnings = map[string]bool{
+	findTypo:      true,
+	findFuture:    true,
+	findRemoved:   true,
+	findPlatform:  true,
+	findRedundant: true,
+}
+
+// finding is a problem found in a file.
+type finding struct {
+	Pos     buildtags.Position
+	Kind    string // kind of finding
+	Message string
+
+	tag string // build tag the finding is about, if any
+}
+
+func (f *finding) String() string {
+	loc := f.Pos.File
+	if f.Pos.Line > 0 {
+		loc += ":" + strconv.Itoa(f.Pos.Line)
+	}
+
+	return loc + ": " + f.Message + " [" + f.Kind + "]"
+}
+
+// runCheck checks that the build tags in the specified packages conform to the
+// policies specified by the command flags, and prints all the findings.  An
+// error is returned if there is at least one finding of the kinds specified by
+// the -fail-on flag.
+func runCheck(ctx context.Context, args []string) error {
+	failing, err := failkinds(*failon)
+	if err != nil {
+		return err
+	}
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	// The release tags satisfied by the toolchain are only used to
+	// report the newer ones, so a failure is not fatal.
+	version, err := buildtags.GoVersion(ctx)
+	if err != nil {
+		log.Printf("check: %v", err)
+	}
+	findings := check(report, version)
+	if *baseline != "" {
+		findings, err = filterbaseline(*baseline, report, findings)
+		if err != nil {
+			return err
+		}
+	}
+	if err := printfindings(os.Stdout, findings); err != nil {
+		return err
+	}
+	n := 0
+	for _, f := range findings {
+		if failing[f.Kind] {
+			n++
+		}
+	}
+	if n > 0 {
+		return fmt.Errorf("check: %d policy violations", n)
+	}
+
+	return nil
+}
+
+// failkinds returns the set of finding kinds in the comma separated list s,
+// or all the kinds except the warnings if s is empty.
+func failkinds(s string) (map[string]bool, error) {
+	list := split(s)
+	if len(list) == 0 {
+		failing := set(kinds)
+		for kind := range warnings {
+			delete(failing, kind)
+		}
+
+		return failing, nil
+	}
+
+	known := set(kinds)
+	for _, kind := range list {
+		if !known[kind] {
+			return nil, fmt.Errorf("check: invalid -fail-on kind %q, want one of %s",
+				kind, strings.Join(kinds, ", "))
+		}
+	}
+
+	return set(list), nil
+}
+
+// check returns all the policy violations in the report.  The release tags
+// newer than the toolchain Go version, if known, are reported too.
+func check(report *buildtags.Report, version string) []*finding {
+	released := set(buildtags.ReleaseTags(version))
+	allowed := set(split(*only))
+	custom := set(append(split(*allow), cfg.Allow...))
+	denied := set(append(split(*deny), cfg.Deny...))
+
+	// An allowlist of custom tags implies that the other custom tags are
+	// disallowed.
+	nocustom := *nocustom || len(custom) > 0
+
+	findings := make([]*finding, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			for _, tag := range file.Tags {
+				// A project tag named like a platform changes
+				// meaning when cross-compiling.
+				platform := platformtag(tag)
+				// A misspelled tag silently excludes the file.
+				suggestion := ""
+				if tag.Category == buildtags.BuildTag && !custom[tag.Name] && platform == "" {
+					suggestion = buildtags.Suggest(tag.Name)
+				}
+				// A newer release tag can not be satisfied by
+				// the toolchain.
+				future := tag.Category == buildtags.ReleaseTag && len(released) > 0 && !released[tag.Name]
+				// Code for a removed platform is dead, and can be
+				// cleaned up.
+				removed := ""
+				if tag.Category == buildtags.GOOS || tag.Category == buildtags.GOARCH {
+					removed = buildtags.RemovedTag(tag.Name)
+				}
+				for _, pos := range tag.Positions {
+					if platform != "" {
+						findings = append(findings, &finding{
+							Pos:     pos,
+							Kind:    findPlatform,
+							Message: platform,
+							tag:     tag.Name,
+						})
+					}
+					if removed != "" {
+						findings = append(findings, &finding{
+							Pos:  pos,
+							Kind: findRemoved,
+							Message: string(tag.Category) + " " + strconv.Quote(tag.Name) + " was removed in " +
+								removed + " and can be cleaned up",
+							tag: tag.Name,
+						})
+					}
+					if future {
+						findings = append(findings, &finding{
+							Pos:  pos,
+							Kind: findFuture,
+							Message: "release tag " + strconv.Quote(tag.Name) + " is newer than the toolchain " +
+								version + " and is never satisfied",
+							tag: tag.Name,
+						})
+					}
+					if suggestion != "" {
+						findings = append(findings, &finding{
+							Pos:  pos,
+							Kind: findTypo,
+							Message: "build tag " + strconv.Quote(tag.Name) + " may be misspelled: did you mean " +
+								strconv.Quote(suggestion) + "?",
+							tag: tag.Name,
+						})
+					}
+					if nocustom && tag.Category == buildtags.BuildTag && !custom[tag.Name] {
+						findings = append(findings, &finding{
+							Pos:     pos,
+							Kind:    findCustomTag,
+							Message: "custom build tag " + strconv.Quote(tag.Name),
+							tag:     tag.Name,
+						})
+					}
+					if denied[tag.Name] {
+						findings = append(findings, &finding{
+							Pos:     pos,
+							Kind:    findDenied,
+							Message: "build tag " + strconv.Quote(tag.Name) + " is denied",
+							tag:     tag.Name,
+						})
+					}
+					if len(allowed) > 0 && !allowed[tag.Name] {
+						findings = append(findings, &finding{
+							Pos:     pos,
+							Kind:    findDisallowed,
+							Message: "build tag " + strconv.Quote(tag.Name) + " not allowed",
+							tag:     tag.Name,
+						})
+					}
+				}
+			}
+
+			if ports := removedonly(file); len(ports) > 0 {
+				findings = append(findings, &finding{
+					Pos:     buildtags.Position{File: render(pkg, file.Name)},
+					Kind:    findRemoved,
+					Message: "file is only built on the removed ports " + joinports(ports) + " and can be cleaned up",
+				})
+			}
+
+			if buildtags.NameConflict(file) {
+				goos, goarch := buildtags.ParseFileName(file.Name)
+				suffix := strings.Trim(goos+"_"+goarch, "_")
+				line := 0
+				if len(file.Constraints) > 0 {
+					line = file.Constraints[0].Line
+				}
+				findings = append(findings, &finding{
+					Pos:  buildtags.Position{File: render(pkg, file.Name), Line: line},
+					Kind: findConflict,
+					Message: "file name suffix " + strconv.Quote(suffix) +
+						" contradicts the build constraint, and the file is never built",
+				})
+			}
+			if x, ok := buildtags.NameResidual(file); ok {
+				msg := "build constraint repeats the file name suffix: remove it"
+				if x != nil {
+					msg = "build constraint repeats the file name suffix: simplify it to " +
+						strconv.Quote(x.String())
+				}
+				findings = append(findings, &finding{
+					Pos:     redundantpos(render(pkg, file.Name), file),
+					Kind:    findRedundant,
+					Message: msg + ", or run fix -redundant",
+				})
+			}
+			for _, line := range file.Misplaced {
+				findings = append(findings, &finding{
+					Pos:     buildtags.Position{File: render(pkg, file.Name), Line: line},
+					Kind:    findMisplaced,
+					Message: "build constraint after the file header is ignored",
+				})
+			}
+			for _, line := range file.Unseparated {
+				findings = append(findings, &finding{
+					Pos: buildtags.Position{
+						File:   render(pkg, file.Name),
+						Line:   line,
+						Origin: buildtags.PlusBuild,
+					},
+					Kind:    findNoBlank,
+					Message: "// +build line is ignored: add a blank line after the // +build comment",
+				})
+			}
+			if line, ok := mismatch(file); !ok {
+				findings = append(findings, &finding{
+					Pos: buildtags.Position{
+						File:   render(pkg, file.Name),
+						Line:   line,
+						Origin: buildtags.PlusBuild,
+					},
+					Kind:    findMismatch,
+					Message: "// +build lines do not match the //go:build condition",
+				})
+			}
+
+			if !*noplusbuild {
+				continue
+			}
+			for _, c := range file.Constraints {
+				if c.Origin == buildtags.PlusBuild {
+					findings = append(findings, &finding{
+						Pos: buildtags.Position{
+							File:   render(pkg, file.Name),
+							Line:   c.Line,
+							Origin: c.Origin,
+						},
+						Kind:    findPlusBuild,
+						Message: "legacy // +build line",
+					})
+				}
+			}
+		}
+	}
+
+	return findings
+}
+
+// redundantpos returns the position of the build constraint of file
+// repeating the file name suffix, reported by NameResidual: the //go:build
+// line if present, or the first // +build line repeating the suffix.
+func redundantpos(path string, file *buildtags.File) buildtags.Position {
+	for _, c := range file.Constraints {
+		if c.Origin == buildtags.GoBuild {
+			return buildtags.Position{File: path, Line: c.Line, Origin: c.Origin}
+		}
+	}
+	for _, c := range file.Constraints {
+		single := &buildtags.File{Name: file.Name, Constraints: []*buildtags.Constraint{c}}
+		if _, ok := buildtags.NameResidual(single); ok {
+			return buildtags.Position{File: path, Line: c.Line, Origin: c.Origin}
+		}
+	}
+	c := file.Constraints[0]
+
+	return buildtags.Position{File: path, Line: c.Line, Origin: c.Origin}
+}
+
+// mismatch reports whether the // +build lines in file match its //go:build
+// line, the way gofmt and go vet do: the // +build lines derived from the
+// //go:build expression must denote the same expression as the existing ones.
+// If they do not match, it returns the line of the first // +build line.
+// Files without both syntaxes always match.
+func mismatch(file *buildtags.File) (int, bool) {
+	var gobuild, plusbuild constraint.Expr
+	line := 0
+	for _, c := range file.Constraints {
+		switch {
+		case c.Origin == buildtags.GoBuild:
+			gobuild = c.Expr
+		case plusbuild == nil:
+			plusbuild, line = c.Expr, c.Line
+		default:
+			plusbuild = &constraint.AndExpr{X: plusbuild, Y: c.Expr}
+		}
+	}
+	if gobuild == nil || plusbuild == nil {
+		return 0, true
+	}
+
+	lines, err := constraint.PlusBuildLines(gobuild)
+	if err != nil {
+		// The expression is too complex for // +build lines, so they
+		// can not match.
+		return line, false
+	}
+	var want constraint.Expr
+	for _, l := range lines {
+		x, err := constraint.Parse(l)
+		if err != nil {
+			return line, false
+		}
+		if want == nil {
+			want = x
+		} else {
+			want = &constraint.AndExpr{X: want, Y: x}
+		}
+	}
+	if want.String() != plusbuild.String() {
+		return line, false
+	}
+
+	return line, true
+}
+
+// platformtag returns a message if the project-defined tag, a custom tag or a
+// tag overridden by the configuration, is named like a GOOS or GOARCH value,
+// or is likely to be in a future Go release.  Otherwise it returns an empty
+// string.
+func platformtag(tag *buildtags.Tag) string {
+	if tag.Category == buildtags.GOOS || tag.Category == buildtags.GOARCH {
+		return ""
+	}
+	like := buildtags.LikePlatform(tag.Name)
+	switch {
+	case like == "":
+		return ""
+	case buildtags.Categorize(tag.Name) == like:
+		return "custom tag " + strconv.Quote(tag.Name) + " collides with a " + string(like) +
+			" value and changes meaning when cross-compiling"
+	case tag.Category == buildtags.BuildTag:
+		return "custom tag " + strconv.Quote(tag.Name) + " looks like a " + string(like) +
+			" value and may collide with a future port"
+	}
+
+	return ""
+}
+
+// removedonly returns the removed ports where file is built, when it is not
+// built on any supported port.  Files using a removed GOOS or GOARCH tag are
+// already reported for the tag, and are skipped.
+func removedonly(file *buildtags.File) []buildtags.Port {
+	for _, tag := range file.Tags {
+		if tag.Category == buildtags.GOOS || tag.Category == buildtags.GOARCH {
+			if buildtags.RemovedTag(tag.Name) != "" {
+				return nil
+			}
+		}
+	}
+
+	return buildtags.RemovedOnly(file)
+}
+
+// joinports returns the comma separated list of ports, each annotated with
+// the Go release that removed it.
+func joinports(ports []buildtags.Port) string {
+	list := make([]string, 0, len(ports))
+	for _, p := range ports {
+		list = append(list, p.String()+" ("+p.Removed()+")")
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// filterbaseline returns the findings about the tags not recorded in the
+// named baseline file, adding a finding for each position of these tags.
+// Findings not about a tag are always returned.
+//
+// If the baseline file does not exist, it is created with the tags in the
+// report and no tag findings are returned.
+func filterbaseline(name string, report *buildtags.Report, findings []*finding) ([]*finding, error) {
+	known, err := readbaseline(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		known = make(map[string]bool)
+		for _, tag := range report.Tags() {
+			known[tag.Name] = true
+		}
+		if err := writebaseline(name, known); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	list := make([]*finding, 0)
+	for _, f := range findings {
+		if f.tag == "" || !known[f.tag] {
+			list = append(list, f)
+		}
+	}
+	for _, tag := range report.Tags() {
+		if known[tag.Name] {
+			continue
+		}
+		for _, pos := range tag.Positions {
+			list = append(list, &finding{
+				Pos:     pos,
+				Kind:    findNewTag,
+				Message: "build tag " + strconv.Quote(tag.Name) + " not in baseline",
+				tag:     tag.Name,
+			})
+		}
+	}
+
+	return list, nil
+}
+
+// readbaseline returns the set of tags recorded in the named baseline file,
+// one tag per line.  Empty lines and lines starting with # are ignored.
+func readbaseline(name string) (map[string]bool, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[line] = true
+	}
+
+	return set, nil
+}
+
+// writebaseline records the set of tags in the named baseline file.
+func writebaseline(name string, set map[string]bool) error {
+	tags := make([]string, 0, len(set))
+	for tag := range set {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("# Build tags baseline, generated by go-buildtags check.\n")
+	for _, tag := range tags {
+		buf.WriteString(tag + "\n")
+	}
+
+	return os.WriteFile(name, buf.Bytes(), 0o666)
+}
+
+// printfindings writes the findings to w, using the format specified by the
+// -format flag.
+func printfindings(w io.Writer, findings []*finding) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(findings)
+	}
+	for _, f := range findings {
+		fmt.Fprintln(w, f)
+	}
+
+	return nil
+}
+
+// set returns a set with the elements of list.
+func set(list []string) map[string]bool {
+	m := make(map[string]bool)
+	for _, v := range list {
+		m[v] = true
+	}
+
+	return m
+}
+
+// split splits a comma separated list, ignoring empty elements and
+// surrounding white space.
+func split(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
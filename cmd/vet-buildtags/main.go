@@ -0,0 +1,19 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vet-buildtags runs the buildtags analyzer, and it is designed to be invoked
+// by go vet:
+//
+//	go vet -vettool=$(which vet-buildtags) -buildtags.report ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/unitchecker"
+
+	"github.com/perillo/go-buildtags/analyzer"
+)
+
+func main() {
+	unitchecker.Main(analyzer.Analyzer)
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// compilers is the list of the compilers supported by the go command.
+var compilers = []string{"gc", "gccgo"}
+
+// compilerfile is a file only built by some compilers.
+type compilerfile struct {
+	File      string   // file path
+	Compilers []string // compilers building the file
+}
+
+// compilerfiles returns the files in the report only built by some of the
+// compilers, useful for gccgo and tinygo portability audits.
+func compilerfiles(report *buildtags.Report) []*compilerfile {
+	list := make([]*compilerfile, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			x := effective(file)
+			if x == nil {
+				continue
+			}
+			built := make([]string, 0, len(compilers))
+			for _, c := range compilers {
+				// Only one compiler is used for a build.
+				values := make(map[string]bool)
+				for _, other := range compilers {
+					values[other] = other == c
+				}
+				if !unsatisfiable(x, values) {
+					built = append(built, c)
+				}
+			}
+			if len(built) < len(compilers) {
+				list = append(list, &compilerfile{File: render(pkg, file.Name), Compilers: built})
+			}
+		}
+	}
+
+	return list
+}
+
+// printcompiler writes to w the compiler-specific files, with the compilers
+// building them.  A file built by no compiler has an unsatisfiable
+// constraint.
+func printcompiler(w io.Writer, files []*compilerfile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "compiler-file:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, strings.Join(f.Compilers, ","))
+	}
+
+	return tw.Flush()
+}
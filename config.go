@@ -0,0 +1,248 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// configName is the name of the configuration file.
+const configName = ".go-buildtags.yaml"
+
+// config is the content of the configuration file.
+type config struct {
+	Flags      map[string][]string           `yaml:"flags"`      // default flags for each command
+	Ignore     []string                      `yaml:"ignore"`     // patterns of the files to ignore
+	Allow      []string                      `yaml:"allow"`      // allowed custom tags
+	Deny       []string                      `yaml:"deny"`       // denied tags
+	Categories map[string]buildtags.Category `yaml:"categories"` // category overrides
+	Tags       map[string]*knowntag          `yaml:"tags"`       // known custom tags
+	Ecosystems map[string][]string           `yaml:"ecosystems"` // tags of alternate toolchains
+	Aliases    map[string]string             `yaml:"aliases"`    // historical tag names and the canonical ones
+
+	dir     string   // directory containing the configuration file
+	special []string // tags promoted to special-tag by the -special flag
+}
+
+// knowntag is a custom tag declared in the configuration file.
+type knowntag struct {
+	Category    buildtags.Category `yaml:"category"`    // category, possibly a new one
+	Description string             `yaml:"description"` // description, reported with the tag
+}
+
+// cfg is the loaded configuration.  It is empty when there is no
+// configuration file.
+var cfg = new(config)
+
+// loadconfig searches the configuration file in the current directory and in
+// its parents, stopping at the module root containing a go.mod file, and
+// returns its content.  An empty configuration is returned if the file is not
+// found.
+func loadconfig() (*config, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		c, err := readconfig(filepath.Join(dir, configName))
+		if err == nil {
+			return c, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	return new(config), nil
+}
+
+// readconfig reads and validates the named configuration file.
+func readconfig(name string) (*config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	c := new(config)
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("config: %s: %v", name, err)
+	}
+	c.dir = filepath.Dir(name)
+
+	for cmd := range c.Flags {
+		if lookup(cmd) == nil {
+			return nil, fmt.Errorf("config: %s: unknown command %q", name, cmd)
+		}
+	}
+	for _, pattern := range c.Ignore {
+		if !validglob(pattern) {
+			return nil, fmt.Errorf("config: %s: invalid ignore pattern %q", name, pattern)
+		}
+	}
+	for tag, category := range c.Categories {
+		if !validcategory(category) {
+			return nil, fmt.Errorf("config: %s: invalid category %q for tag %q", name, category, tag)
+		}
+	}
+	for tag, known := range c.Tags {
+		if known == nil || known.Category == "" {
+			return nil, fmt.Errorf("config: %s: missing category for tag %q", name, tag)
+		}
+	}
+	for alias, canonical := range c.Aliases {
+		if !istag(alias) || !istag(canonical) || alias == canonical {
+			return nil, fmt.Errorf("config: %s: invalid alias %q for tag %q", name, alias, canonical)
+		}
+		if _, ok := c.Aliases[canonical]; ok {
+			return nil, fmt.Errorf("config: %s: canonical tag %q is an alias", name, canonical)
+		}
+	}
+	if err := c.addecosystems(); err != nil {
+		return nil, fmt.Errorf("config: %s: %v", name, err)
+	}
+
+	return c, nil
+}
+
+// addecosystems adds the tags of each ecosystem to the known custom tags, in
+// a category named after the ecosystem, like tinygo, so that the tags of an
+// alternate toolchain are grouped and labeled instead of being reported as
+// unrelated custom tags.
+func (c *config) addecosystems() error {
+	if len(c.Ecosystems) > 0 && c.Tags == nil {
+		c.Tags = make(map[string]*knowntag)
+	}
+	owner := make(map[string]string)
+	for eco, tags := range c.Ecosystems {
+		if validcategory(buildtags.Category(eco)) {
+			return fmt.Errorf("ecosystem %q conflicts with the category with the same name", eco)
+		}
+		for _, tag := range tags {
+			if other, ok := owner[tag]; ok {
+				return fmt.Errorf("tag %q in both the %q and %q ecosystems", tag, other, eco)
+			}
+			if c.Tags[tag] != nil {
+				return fmt.Errorf("tag %q in the %q ecosystem is also declared in tags", tag, eco)
+			}
+			owner[tag] = eco
+		}
+	}
+	for tag, eco := range owner {
+		c.Tags[tag] = &knowntag{
+			Category:    buildtags.Category(eco),
+			Description: "tag of the " + eco + " ecosystem",
+		}
+	}
+
+	return nil
+}
+
+// ignored reports whether the file with the specified path matches one of the
+// ignore patterns, relative to the configuration file directory.
+func (c *config) ignored(name string) bool {
+	return excluded(c.dir, c.Ignore, name)
+}
+
+// options returns the scanner options specified by the configuration.
+func (c *config) options() []buildtags.Option {
+	opts := make([]buildtags.Option, 0)
+	if overrides := c.overrides(); len(overrides) > 0 {
+		opts = append(opts, buildtags.WithTagCategories(overrides))
+	}
+
+	return opts
+}
+
+// overrides returns the category of the tags overridden by the
+// configuration and by the -special flag.
+func (c *config) overrides() map[string]buildtags.Category {
+	overrides := make(map[string]buildtags.Category)
+	for tag, category := range c.Categories {
+		overrides[tag] = category
+	}
+	for tag, known := range c.Tags {
+		overrides[tag] = known.Category
+	}
+	for _, tag := range c.special {
+		overrides[tag] = buildtags.SpecialTag
+	}
+
+	return overrides
+}
+
+// categories returns all the categories, including the new ones declared in
+// the tags section of the configuration, sorted by name and reported before
+// the generic build-tag category.
+func (c *config) categories() []buildtags.Category {
+	custom := make([]buildtags.Category, 0)
+	seen := make(map[buildtags.Category]bool)
+	for _, known := range c.Tags {
+		if !validcategory(known.Category) && !seen[known.Category] {
+			seen[known.Category] = true
+			custom = append(custom, known.Category)
+		}
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i] < custom[j] })
+
+	list := make([]buildtags.Category, 0, len(buildtags.Categories)+len(custom))
+	for _, category := range buildtags.Categories {
+		if category == buildtags.BuildTag {
+			list = append(list, custom...)
+		}
+		list = append(list, category)
+	}
+
+	return list
+}
+
+// known returns category if it is one of the categories of the
+// configuration, otherwise BuildTag, like for the custom categories of a
+// report rendered with a different configuration.
+func (c *config) known(category buildtags.Category) buildtags.Category {
+	for _, x := range c.categories() {
+		if x == category {
+			return category
+		}
+	}
+
+	return buildtags.BuildTag
+}
+
+// description returns the description of the tag declared in the
+// configuration, or an empty string.
+func (c *config) description(tag string) string {
+	if known := c.Tags[tag]; known != nil {
+		return known.Description
+	}
+
+	return ""
+}
+
+// validcategory reports whether c is a known category.
+func validcategory(c buildtags.Category) bool {
+	for _, category := range buildtags.Categories {
+		if c == category {
+			return true
+		}
+	}
+
+	return false
+}
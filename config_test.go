@@ -0,0 +1,94 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// TestIgnored tests the config.ignored method.
+func TestIgnored(t *testing.T) {
+	c := &config{
+		Ignore: []string{"internal/gen", "*_string.go", "cmd/*/main.go"},
+		dir:    filepath.FromSlash("/mod"),
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/mod/internal/gen/a.go", true},
+		{"/mod/internal/gen/sub/a.go", true},
+		{"/mod/internal/a.go", false},
+		{"/mod/kind_string.go", true},
+		{"/mod/pkg/kind_string.go", true},
+		{"/mod/cmd/tool/main.go", true},
+		{"/mod/cmd/tool/flags.go", false},
+		{"/other/internal/gen/a.go", false},
+		{"/other/kind_string.go", false},
+	}
+	for _, test := range tests {
+		if got := c.ignored(filepath.FromSlash(test.path)); got != test.want {
+			t.Errorf("ignored(%q): want %v, got %v", test.path, test.want, got)
+		}
+	}
+}
+
+// TestCategories tests the config.categories method.
+func TestCategories(t *testing.T) {
+	c := &config{
+		Tags: map[string]*knowntag{
+			"featx":  {Category: "feature-flag"},
+			"featy":  {Category: "feature-flag"},
+			"tinygo": {Category: buildtags.SpecialTag},
+			"beta":   {Category: "channel"},
+		},
+	}
+	got := c.categories()
+	n := len(buildtags.Categories)
+	want := append(append([]buildtags.Category{}, buildtags.Categories[:n-1]...),
+		"channel", "feature-flag", buildtags.BuildTag)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+// TestAddEcosystems tests the config.addecosystems method.
+func TestAddEcosystems(t *testing.T) {
+	c := &config{
+		Ecosystems: map[string][]string{
+			"tinygo": {"tinygo", "baremetal"},
+			"tamago": {"tamago"},
+		},
+	}
+	if err := c.addecosystems(); err != nil {
+		t.Fatalf("addecosystems: %v", err)
+	}
+	want := map[string]*knowntag{
+		"tinygo":    {Category: "tinygo", Description: "tag of the tinygo ecosystem"},
+		"baremetal": {Category: "tinygo", Description: "tag of the tinygo ecosystem"},
+		"tamago":    {Category: "tamago", Description: "tag of the tamago ecosystem"},
+	}
+	if !reflect.DeepEqual(c.Tags, want) {
+		t.Errorf("want %v, got %v", want, c.Tags)
+	}
+
+	invalid := []*config{
+		{Ecosystems: map[string][]string{"special-tag": {"tinygo"}}},
+		{Ecosystems: map[string][]string{"tinygo": {"wasm32"}, "wasi": {"wasm32"}}},
+		{
+			Tags:       map[string]*knowntag{"tinygo": {Category: buildtags.SpecialTag}},
+			Ecosystems: map[string][]string{"tinygo": {"tinygo"}},
+		},
+	}
+	for _, c := range invalid {
+		if err := c.addecosystems(); err == nil {
+			t.Errorf("addecosystems(%v): want error, got nil", c.Ecosystems)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build/constraint"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+
+	"github.com/perillo/go-buildtags/buildtags"
+	"github.com/perillo/go-buildtags/internal/invoke"
+	"github.com/perillo/go-buildtags/internal/walk"
+)
+
+var diffCmd = &command{
+	name:  "diff",
+	args:  "old new",
+	short: "compare the build tags between two revisions or directories",
+	flags: diffFlags,
+	run:   runDiff,
+}
+
+// diff command flags.
+var (
+	diffFlags = flag.NewFlagSet("diff", flag.ExitOnError)
+)
+
+// change is a file whose build constraints changed.
+type change struct {
+	File string // file path, relative to the tree root
+	Old  string // old constraint expression, empty if none
+	New  string // new constraint expression, empty if none
+}
+
+// delta is the difference between the build tags of two source trees.
+type delta struct {
+	Added   []string  // tags only used in the new tree
+	Removed []string  // tags only used in the old tree
+	Changed []*change // files whose constraints changed
+}
+
+// runDiff reports the build tags added and removed, and the files whose
+// constraints changed, between two git revisions or two directories.
+func runDiff(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("diff: old and new must be specified")
+	}
+
+	trees := make([]*buildtags.Report, 0, 2)
+	for _, arg := range args {
+		fsys, err := open(ctx, arg)
+		if err != nil {
+			return err
+		}
+		report, err := scantree(ctx, fsys)
+		if err != nil {
+			return err
+		}
+		trees = append(trees, report)
+	}
+
+	return printdelta(os.Stdout, compare(trees[0], trees[1]))
+}
+
+// open returns the file system for the source tree named by arg: a directory
+// if arg is an existing directory, otherwise the current directory in the
+// arg git revision.
+func open(ctx context.Context, arg string) (fs.FS, error) {
+	if fi, err := os.Stat(arg); err == nil && fi.IsDir() {
+		return os.DirFS(arg), nil
+	}
+
+	// The output of git archive is binary, so invoke.Output can not be used
+	// since it trims whitespace.
+	buf := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, "git", "archive", "--format=zip", arg+":./")
+	cmd.Stdout = buf
+	if err := invoke.Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// scantree scans all the package directories in fsys, skipping the
+// directories ignored by the go command pattern ./...
+func scantree(ctx context.Context, fsys fs.FS) (*buildtags.Report, error) {
+	dirs, err := walk.Match(fsys, "...", walk.Options{FollowSymlinks: symlinks, MaxDepth: -1})
+	if err != nil {
+		return nil, err
+	}
+
+	return newscanner().ScanFS(ctx, fsys, dirs)
+}
+
+// compare returns the difference between the build tags in the old and cur
+// reports.
+func compare(old, cur *buildtags.Report) *delta {
+	d := &delta{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]*change, 0),
+	}
+
+	oldtags, curtags := tagnames(old), tagnames(cur)
+	for tag := range curtags {
+		if !oldtags[tag] {
+			d.Added = append(d.Added, tag)
+		}
+	}
+	for tag := range oldtags {
+		if !curtags[tag] {
+			d.Removed = append(d.Removed, tag)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+
+	oldexprs, curexprs := exprs(old), exprs(cur)
+	paths := make([]string, 0)
+	for p := range oldexprs {
+		paths = append(paths, p)
+	}
+	for p := range curexprs {
+		if _, ok := oldexprs[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if oldexprs[p] != curexprs[p] {
+			d.Changed = append(d.Changed, &change{File: p, Old: oldexprs[p], New: curexprs[p]})
+		}
+	}
+
+	return d
+}
+
+// tagnames returns the set of build tags used in the report.
+func tagnames(report *buildtags.Report) map[string]bool {
+	set := make(map[string]bool)
+	for _, tag := range report.Tags() {
+		set[tag.Name] = true
+	}
+
+	return set
+}
+
+// exprs maps the path of each file in the report to its effective build
+// constraint expression, including the file name tags.  Files without
+// constraints are mapped to an empty string.
+func exprs(report *buildtags.Report) map[string]string {
+	m := make(map[string]string)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			expr := ""
+			if x := effective(file); x != nil {
+				expr = x.String()
+			}
+			m[path.Join(pkg.Dir, file.Name)] = expr
+		}
+	}
+
+	return m
+}
+
+// effective returns the build constraint expression of file, combined with
+// the GOOS and GOARCH values in the file name.  It returns nil if the file
+// has no constraints.
+func effective(file *buildtags.File) constraint.Expr {
+	var expr constraint.Expr
+	goos, goarch := buildtags.ParseFileName(file.Name)
+	for _, x := range []constraint.Expr{tagexpr(goos), tagexpr(goarch), file.Expr()} {
+		switch {
+		case x == nil:
+		case expr == nil:
+			expr = x
+		default:
+			expr = &constraint.AndExpr{X: expr, Y: x}
+		}
+	}
+
+	return expr
+}
+
+// tagexpr returns an expression for tag, or nil if tag is empty.
+func tagexpr(tag string) constraint.Expr {
+	if tag == "" {
+		return nil
+	}
+
+	return &constraint.TagExpr{Tag: tag}
+}
+
+// printdelta writes d to w, using the output format.
+func printdelta(w io.Writer, d *delta) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(d)
+	}
+
+	for _, tag := range d.Added {
+		fmt.Fprintf(w, "+tag %s\n", tag)
+	}
+	for _, tag := range d.Removed {
+		fmt.Fprintf(w, "-tag %s\n", tag)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(w, "%s:\n", c.File)
+		if c.Old != "" {
+			fmt.Fprintf(w, "\t-%s\n", c.Old)
+		}
+		if c.New != "" {
+			fmt.Fprintf(w, "\t+%s\n", c.New)
+		}
+	}
+
+	return nil
+}
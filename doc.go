@@ -0,0 +1,153 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var docCmd = &command{
+	name:  "doc",
+	args:  "[packages]",
+	short: "generate a reference of the build tags in the packages",
+	flags: docFlags,
+	run:   runDoc,
+}
+
+// doc command flags.
+var (
+	docFlags = flag.NewFlagSet("doc", flag.ExitOnError)
+	docdescr = docFlags.String("descriptions", "", "read the tag descriptions from the JSON `file`")
+	docCtx   = newContextFlags(docFlags)
+)
+
+// tagdoc is the reference documentation for a build tag.
+type tagdoc struct {
+	Name        string
+	Category    buildtags.Category
+	Description string   `json:",omitempty"`
+	Default     bool     // whether the tag is set in the build context
+	Files       []string // positions where the tag is specified
+}
+
+// runDoc prints a reference of the build tags in the specified packages,
+// using the descriptions from the file specified by the -descriptions flag.
+//
+// Tags that are described but not used, and custom tags that are used but
+// not described, are reported on stderr, so that the descriptions can be kept
+// in sync with the code.
+func runDoc(ctx context.Context, args []string) error {
+	descriptions := make(map[string]string)
+	if *docdescr != "" {
+		data, err := os.ReadFile(*docdescr)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &descriptions); err != nil {
+			return fmt.Errorf("doc: %s: %v", *docdescr, err)
+		}
+	}
+
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	bctx := docCtx.context()
+	used := make(map[string]bool)
+	list := make([]*tagdoc, 0)
+	for _, tag := range report.Tags() {
+		used[tag.Name] = true
+		doc := &tagdoc{
+			Name:        tag.Name,
+			Category:    tag.Category,
+			Description: describe(descriptions, tag.Name),
+			Default:     bctx.MatchTag(tag.Name),
+			Files:       make([]string, 0, len(tag.Positions)),
+		}
+		for _, pos := range tag.Positions {
+			loc := pos.File
+			if pos.Line > 0 {
+				loc += ":" + strconv.Itoa(pos.Line)
+			}
+			doc.Files = append(doc.Files, loc)
+		}
+		if *docdescr != "" && doc.Description == "" && tag.Category == buildtags.BuildTag {
+			fmt.Fprintf(os.Stderr, "doc: tag %s is not described\n", tag.Name)
+		}
+		list = append(list, doc)
+	}
+
+	stale := make([]string, 0)
+	for name := range descriptions {
+		if !used[name] {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		fmt.Fprintf(os.Stderr, "doc: tag %s is described but not used\n", name)
+	}
+
+	return printdoc(os.Stdout, list)
+}
+
+// printdoc writes the tag reference to w, using the output format.  The text
+// format is Markdown.
+func printdoc(w io.Writer, list []*tagdoc) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(list)
+	}
+
+	fmt.Fprintln(w, "# Build tags")
+	for _, doc := range list {
+		fmt.Fprintf(w, "\n## %s\n\n", doc.Name)
+		if doc.Description != "" {
+			fmt.Fprintf(w, "%s\n\n", doc.Description)
+		}
+		fmt.Fprintf(w, "Category: %s, default: %s.\n\n", doc.Category, defaultstate(doc.Default))
+		fmt.Fprintf(w, "Files:\n\n")
+		for _, loc := range doc.Files {
+			fmt.Fprintf(w, "- %s\n", loc)
+		}
+	}
+
+	return nil
+}
+
+// describe returns the description of the tag from the descriptions read
+// from the -descriptions file, falling back to the configuration file and to
+// the knowledge base of the well-known tags.
+func describe(descriptions map[string]string, tag string) string {
+	if d := descriptions[tag]; d != "" {
+		return d
+	}
+	if d := cfg.description(tag); d != "" {
+		return d
+	}
+
+	return buildtags.Describe(tag)
+}
+
+// defaultstate returns the description of the default state of a tag.
+func defaultstate(set bool) string {
+	if set {
+		return "set"
+	}
+
+	return "not set"
+}
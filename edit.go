@@ -0,0 +1,58 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// lineedit is an edit of a line in a file.
+type lineedit struct {
+	insert string // text to insert before the line
+	delete bool   // delete the line
+}
+
+// apply applies the line edits, indexed by the line number, to the named file.
+// If diff is true, the changes are displayed; if write is true the file is
+// rewritten, otherwise the file name is printed.  name is the file name shown
+// to the user.
+func apply(path, name string, edits map[int]lineedit, diff, write bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := splitlines(src)
+	buf := new(bytes.Buffer)
+	for i, line := range lines {
+		edit := edits[i+1]
+		buf.WriteString(edit.insert)
+		if !edit.delete {
+			buf.WriteString(line)
+		}
+	}
+	dst := buf.Bytes()
+	if bytes.Equal(src, dst) {
+		return nil
+	}
+
+	switch {
+	case diff:
+		os.Stdout.Write(unified(name, src, dst))
+	case write:
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, dst, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	default:
+		fmt.Println(name)
+	}
+
+	return nil
+}
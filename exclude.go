@@ -0,0 +1,133 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+	"github.com/perillo/go-buildtags/internal/walk"
+)
+
+// stringsFlag is a flag.Value collecting the values of a repeated flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+
+	return nil
+}
+
+// excluded reports whether the file with the specified path matches one of
+// the glob patterns.  Patterns are matched against the slash separated path
+// relative to dir, and against each of its parent directories.  Like in
+// .gitignore, a pattern without a slash is matched against the last element
+// only.
+func excluded(dir string, patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	name, err = filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	for p := filepath.ToSlash(rel); p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			name := p
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(p)
+			}
+			if glob(pattern, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// glob reports whether the slash separated name matches the pattern.  Each
+// pattern element uses the path.Match syntax, except for the ** element that
+// matches zero or more elements.
+func glob(pattern, name string) bool {
+	return globelems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// globelems is like glob, but for the pattern and name elements.
+func globelems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if globelems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// validglob reports whether the glob pattern is well formed.
+func validglob(pattern string) bool {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// excludepackages returns the packages whose import path does not match any
+// of the patterns, using the go command pattern syntax, like
+// example.com/legacy/....
+func excludepackages(packages []*buildtags.Package, patterns []string) []*buildtags.Package {
+	matchers := make([]func(string) bool, 0, len(patterns))
+	for _, pattern := range patterns {
+		matchers = append(matchers, walk.MatchPattern(pattern))
+	}
+
+	list := make([]*buildtags.Package, 0, len(packages))
+	for _, pkg := range packages {
+		skip := false
+		for _, match := range matchers {
+			if match(pkg.ImportPath) {
+				skip = true
+
+				break
+			}
+		}
+		if !skip {
+			list = append(list, pkg)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// TestGlob tests the glob function.
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"zz_*.go", "zz_generated.go", true},
+		{"zz_*.go", "a/zz_generated.go", false},
+		{"internal/legacy/**", "internal/legacy/a.go", true},
+		{"internal/legacy/**", "internal/legacy/x/y/a.go", true},
+		{"internal/legacy/**", "internal/legacy", true},
+		{"internal/legacy/**", "internal/other/a.go", false},
+		{"**/mock_*.go", "mock_a.go", true},
+		{"**/mock_*.go", "a/b/mock_a.go", true},
+		{"a/**/z.go", "a/z.go", true},
+		{"a/**/z.go", "a/b/c/z.go", true},
+		{"a/**/z.go", "b/z.go", false},
+		{"a/*", "a/b/c", false},
+	}
+	for _, test := range tests {
+		if got := glob(test.pattern, test.name); got != test.want {
+			t.Errorf("glob(%q, %q): want %v, got %v", test.pattern, test.name, test.want, got)
+		}
+	}
+}
+
+// TestExcludepackages tests the excludepackages function.
+func TestExcludepackages(t *testing.T) {
+	packages := []*buildtags.Package{
+		{ImportPath: "example.com/a"},
+		{ImportPath: "example.com/legacy"},
+		{ImportPath: "example.com/legacy/x"},
+		{ImportPath: "example.com/legacyx"},
+	}
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"example.com/legacy/..."}, []string{"example.com/a", "example.com/legacyx"}},
+		{[]string{"example.com/legacy"}, []string{"example.com/a", "example.com/legacy/x", "example.com/legacyx"}},
+		{[]string{"example.com/a", ".../x"}, []string{"example.com/legacy", "example.com/legacyx"}},
+		{[]string{"..."}, []string{}},
+	}
+	for _, test := range tests {
+		got := make([]string, 0)
+		for _, pkg := range excludepackages(packages, test.patterns) {
+			got = append(got, pkg.ImportPath)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("excludepackages(%q): want %q, got %q", test.patterns, test.want, got)
+		}
+	}
+}
+
+// TestLoadExcluded tests that the files excluded with -exclude are never
+// parsed, so that a malformed file does not abort the scan.
+func TestLoadExcluded(t *testing.T) {
+	root := t.TempDir()
+	src := map[string]string{
+		"a.go":              "//go:build linux\n\npackage a\n",
+		"broken/b.go":       "//go:build linux\n\npackage b\n\nfunc {\n",
+		"zz_generated.go":   "package a\n\nimport (\n",
+		"legacy/old/old.go": "//go:build (\n\npackage old\n",
+	}
+	for name, data := range src {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	defer func(mode bool, patterns stringsFlag) {
+		dirmode, excludes = mode, patterns
+	}(dirmode, excludes)
+	dirmode = true
+	excludes = stringsFlag{"zz_*.go", "legacy/**", "broken/b.go"}
+
+	report, err := load(context.Background(), []string{"./..."})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	got := make([]string, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			got = append(got, filepath.ToSlash(filepath.Join(pkg.Dir, file.Name)))
+		}
+	}
+	if want := []string{"a.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want files %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var filesCmd = &command{
+	name:  "files",
+	args:  "[packages]",
+	short: "list the files included and excluded in a build context",
+	flags: filesFlags,
+	run:   runFiles,
+}
+
+// files command flags.
+var (
+	filesFlags = flag.NewFlagSet("files", flag.ExitOnError)
+	filesCtx   = newContextFlags(filesFlags)
+	bykind     = filesFlags.Bool("by-kind", false, "group the files by kind, like GoFiles and SFiles")
+)
+
+// contextFlags are the command line flags specifying a build context, in
+// addition to the shared -goos and -goarch flags.
+type contextFlags struct {
+	cgo  *bool
+	tags *string
+	race *bool
+	msan *bool
+	asan *bool
+}
+
+// newContextFlags defines the build context flags in fs.  The default values
+// are taken from the host build context.
+func newContextFlags(fs *flag.FlagSet) *contextFlags {
+	def := buildtags.DefaultContext()
+
+	return &contextFlags{
+		cgo:  fs.Bool("cgo", def.CgoEnabled, "whether cgo is enabled"),
+		tags: fs.String("tags", "", "comma separated list of additional build tags"),
+		race: fs.Bool("race", false, "build with the race detector, satisfying the race tag"),
+		msan: fs.Bool("msan", false, "build with the memory sanitizer, satisfying the msan tag"),
+		asan: fs.Bool("asan", false, "build with the address sanitizer, satisfying the asan tag"),
+	}
+}
+
+// context returns the build context specified by the flags.
+func (f *contextFlags) context() buildtags.BuildContext {
+	ctx := buildtags.DefaultContext()
+	ctx.GOOS = goosflag
+	ctx.GOARCH = goarchflag
+	ctx.CgoEnabled = *f.cgo
+	ctx.Tags = split(*f.tags)
+
+	// Like the go command, the sanitizer flags set the corresponding
+	// tags.
+	for _, v := range []struct {
+		set bool
+		tag string
+	}{{*f.race, "race"}, {*f.msan, "msan"}, {*f.asan, "asan"}} {
+		if v.set {
+			ctx.Tags = append(ctx.Tags, v.tag)
+		}
+	}
+
+	return ctx
+}
+
+// runFiles prints the Go files in the specified packages that would be
+// included and excluded when building with the build context specified by
+// the command flags.
+func runFiles(ctx context.Context, args []string) error {
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	matches := report.Evaluate(filesCtx.context())
+	if *bykind {
+		return printkinds(os.Stdout, matches)
+	}
+
+	included := make([]string, 0)
+	excluded := make([]string, 0)
+	for _, m := range matches {
+		path := render(m.Package, m.File.Name)
+		if m.Included {
+			included = append(included, path)
+		} else {
+			excluded = append(excluded, path)
+		}
+	}
+
+	return printfiles(os.Stdout, included, excluded)
+}
+
+// filekinds maps a file kind to the files of that kind.
+type filekinds map[buildtags.FileKind][]string
+
+// printkinds writes the included and excluded files to w, grouped by kind as
+// classified by the go/build package, using the format specified by the
+// -format flag.  Empty kinds are omitted.
+func printkinds(w io.Writer, matches []*buildtags.Match) error {
+	included := make(filekinds)
+	excluded := make(filekinds)
+	for _, m := range matches {
+		path := render(m.Package, m.File.Name)
+		kind := m.File.Kind()
+		if m.Included {
+			included[kind] = append(included[kind], path)
+		} else {
+			excluded[kind] = append(excluded[kind], path)
+		}
+	}
+
+	if format == formatJSON {
+		out := struct {
+			Included filekinds
+			Excluded filekinds
+		}{included, excluded}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(out)
+	}
+
+	for _, v := range []struct {
+		label string
+		files filekinds
+	}{{"included", included}, {"excluded", excluded}} {
+		fmt.Fprintln(w, v.label+":")
+		for _, kind := range buildtags.FileKinds {
+			if len(v.files[kind]) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "\t%s:\n", kind)
+			for _, path := range v.files[kind] {
+				fmt.Fprintln(w, "\t\t"+path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// printfiles writes the included and excluded files to w, using the format
+// specified by the -format flag.
+func printfiles(w io.Writer, included, excluded []string) error {
+	if format == formatJSON {
+		out := struct {
+			Included []string
+			Excluded []string
+		}{included, excluded}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(out)
+	}
+
+	fmt.Fprintln(w, "included:")
+	for _, path := range included {
+		fmt.Fprintln(w, "\t"+path)
+	}
+	fmt.Fprintln(w, "excluded:")
+	for _, path := range excluded {
+		fmt.Fprintln(w, "\t"+path)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"go/build/constraint"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var fixCmd = &command{
+	name:  "fix",
+	args:  "[packages]",
+	short: "convert legacy // +build lines to //go:build lines",
+	flags: fixFlags,
+	run:   runFix,
+}
+
+// fix command flags.
+var (
+	fixFlags     = flag.NewFlagSet("fix", flag.ExitOnError)
+	fixdiff      = fixFlags.Bool("diff", false, "display diffs instead of rewriting files")
+	fixwrite     = fixFlags.Bool("w", false, "write result to source file instead of listing it")
+	fixkeep      = fixFlags.Bool("keep", false, "keep the // +build lines, for compatibility with Go < 1.17")
+	fixredundant = fixFlags.Bool("redundant", false, "also remove the constraints repeating the file name suffix, like //go:build linux in foo_linux.go")
+)
+
+// runFix converts the legacy // +build lines in the Go files of the specified
+// packages to an equivalent //go:build line.
+//
+// By default the files that need to be fixed are listed; with -diff the
+// changes are displayed and with -w the files are rewritten.  With -redundant,
+// the constraints repeating the file name suffix are removed too.
+func runFix(ctx context.Context, args []string) error {
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			path := filepath.Join(pkg.Dir, file.Name)
+			edits := fixedits(file)
+			if *fixredundant {
+				redundant, err := redundantedits(path, file)
+				if err != nil {
+					return err
+				}
+				if len(redundant) > 0 {
+					edits = redundant
+				}
+			}
+			if len(edits) == 0 {
+				continue
+			}
+			if err := apply(path, render(pkg, file.Name), edits, *fixdiff, *fixwrite); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fixedits returns the line edits converting the // +build lines of file,
+// indexed by the line number.  Files that already have a //go:build line are
+// not changed.
+func fixedits(file *buildtags.File) map[int]lineedit {
+	var expr constraint.Expr
+	first := 0
+	for _, c := range file.Constraints {
+		if c.Origin == buildtags.GoBuild {
+			return nil
+		}
+		if first == 0 {
+			first = c.Line
+		}
+	}
+	if expr = file.Expr(); expr == nil {
+		return nil
+	}
+
+	edits := make(map[int]lineedit)
+	for _, c := range file.Constraints {
+		edits[c.Line] = lineedit{delete: !*fixkeep}
+	}
+	edits[first] = lineedit{
+		insert: "//go:build " + expr.String() + "\n",
+		delete: !*fixkeep,
+	}
+
+	return edits
+}
+
+// redundantedits returns the line edits removing the parts of the build
+// constraints of the named file that repeat the file name suffix, indexed by
+// the line number.  The constraint lines are replaced by a //go:build line
+// with the residual expression, or deleted with the blank line following them
+// if the whole constraint is implied by the name.
+func redundantedits(path string, file *buildtags.File) (map[int]lineedit, error) {
+	x, ok := buildtags.NameResidual(file)
+	if !ok {
+		return nil, nil
+	}
+
+	edits := make(map[int]lineedit)
+	last := 0
+	for _, c := range file.Constraints {
+		edits[c.Line] = lineedit{delete: true}
+		if c.Line > last {
+			last = c.Line
+		}
+	}
+	if x != nil {
+		first := file.Constraints[0].Line
+		insert := "//go:build " + x.String() + "\n"
+		if *fixkeep {
+			lines, err := constraint.PlusBuildLines(x)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range lines {
+				insert += line + "\n"
+			}
+		}
+		edits[first] = lineedit{insert: insert, delete: true}
+
+		return edits, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitlines(src)
+	if last < len(lines) && strings.TrimSpace(lines[last]) == "" {
+		edits[last+1] = lineedit{delete: true}
+	}
+
+	return edits, nil
+}
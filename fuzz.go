@@ -0,0 +1,92 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// Kinds of fuzzing scaffolding.
+const (
+	fuzzGoFuzz = "go-fuzz" // fuzz target built with a go-fuzz tag, like gofuzz
+	fuzzNative = "native"  // native fuzz test, gated on go1.18 or later
+)
+
+// fuzzfile is a file only built for fuzzing.
+type fuzzfile struct {
+	File string // file path
+	Kind string // go-fuzz or native
+}
+
+// fuzzfiles returns the files in the report only built with a go-fuzz tag,
+// and the fuzz tests gated on the Go 1.18 native fuzzing support, so that the
+// fuzzing scaffolding is reported apart from the production constraints.  The
+// native fuzz tests are recognized by the conventional fuzz in the name.
+func fuzzfiles(report *buildtags.Report) []*fuzzfile {
+	list := make([]*fuzzfile, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			x := effective(file)
+			if x == nil {
+				continue
+			}
+			fuzz := make(map[string]bool)
+			gated := make(map[string]bool)
+			for _, tag := range file.Tags {
+				switch {
+				case tag.Category == buildtags.FuzzTag:
+					fuzz[tag.Name] = false
+				case tag.Category == buildtags.ReleaseTag && nativefuzz(tag.Name):
+					gated[tag.Name] = false
+				}
+			}
+
+			kind := ""
+			switch {
+			case len(fuzz) > 0 && unsatisfiable(x, fuzz):
+				kind = fuzzGoFuzz
+			case len(gated) > 0 && isfuzztest(file.Name) && unsatisfiable(x, gated):
+				kind = fuzzNative
+			}
+			if kind != "" {
+				list = append(list, &fuzzfile{File: render(pkg, file.Name), Kind: kind})
+			}
+		}
+	}
+
+	return list
+}
+
+// nativefuzz reports whether the release tag implies the native fuzzing
+// support, added in Go 1.18.
+func nativefuzz(tag string) bool {
+	minor, err := strconv.Atoi(strings.TrimPrefix(tag, "go1."))
+
+	return err == nil && minor >= 18
+}
+
+// isfuzztest reports whether the named file is a test file with fuzz in the
+// name, like fuzz_test.go or parser_fuzz_test.go.
+func isfuzztest(name string) bool {
+	return strings.HasSuffix(name, "_test.go") && strings.Contains(strings.ToLower(name), "fuzz")
+}
+
+// printfuzz writes to w the files only built for fuzzing, with the kind of
+// fuzzing scaffolding.
+func printfuzz(w io.Writer, files []*fuzzfile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "fuzz-file:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, f.Kind)
+	}
+
+	return tw.Flush()
+}
@@ -1,3 +1,8 @@
 module github.com/perillo/go-buildtags
 
 go 1.16
+
+require (
+	golang.org/x/tools v0.1.12
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,105 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// group is the report of the packages in a group, like a module or a root
+// directory.
+type group struct {
+	Name   string            // group name, like the module path
+	Report *buildtags.Report // packages in the group
+}
+
+// bymodule splits the report by module, in the order the modules are first
+// found.  Packages not in a module are grouped as std.
+func bymodule(report *buildtags.Report) []*group {
+	index := make(map[string]*group)
+	list := make([]*group, 0)
+	for _, pkg := range report.Packages {
+		mod := "std"
+		if pkg.Module != nil {
+			mod = pkg.Module.Path
+		}
+		g, ok := index[mod]
+		if !ok {
+			g = newgroup(mod)
+			index[mod] = g
+			list = append(list, g)
+		}
+		g.Report.Packages = append(g.Report.Packages, pkg)
+	}
+
+	return list
+}
+
+// byroot splits the report by the root directories specified with the -root
+// flag, in the order of the roots.  Each package is attributed to all the
+// roots containing its directory, since packages are scanned only once even
+// when requested by several roots; packages outside all the roots, like the
+// dependencies, are not reported.
+func byroot(report *buildtags.Report, roots []string) []*group {
+	list := make([]*group, 0, len(roots))
+	for _, root := range roots {
+		list = append(list, newgroup(root))
+	}
+
+	for _, pkg := range report.Packages {
+		dir := resolve(pkg.Dir)
+		for i, root := range roots {
+			root = resolve(root)
+			if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+				g := list[i]
+				g.Report.Packages = append(g.Report.Packages, pkg)
+			}
+		}
+	}
+
+	return list
+}
+
+// newgroup returns a new empty group with the specified name.
+func newgroup(name string) *group {
+	return &group{
+		Name:   name,
+		Report: &buildtags.Report{Packages: make([]*buildtags.Package, 0)},
+	}
+}
+
+// pkgfiles is a package with the files selected by filesbypkg.
+type pkgfiles struct {
+	Name    string             // import path, or directory if not known
+	Package *buildtags.Package // the package containing the files
+	Files   []*buildtags.File  // selected files
+}
+
+// filesbypkg returns, for each package in the report, the files for which
+// match returns true.  The packages without such files are not reported.
+func filesbypkg(report *buildtags.Report, match func(*buildtags.File) bool) []*pkgfiles {
+	list := make([]*pkgfiles, 0)
+	for _, pkg := range report.Packages {
+		files := make([]*buildtags.File, 0)
+		for _, file := range pkg.Files {
+			if match(file) {
+				files = append(files, file)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		name := pkg.ImportPath
+		if name == "" {
+			name = pkg.Dir
+		}
+		list = append(list, &pkgfiles{Name: name, Package: pkg, Files: files})
+	}
+
+	return list
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The code for the MatchPattern function has been adapted from the matchPattern
+// function from src/cmd/go/internal/search/search.go in the Go source
+// distribution.
+// Copyright 2017 The Go Authors. All rights reserved.
+
+// Package walk finds the package directories matching the go command package
+// patterns, like ./..., without invoking the go command.
+//
+// Like the go command, directories named testdata or vendor, or whose name
+// starts with "." or "_", and the directories of nested modules, are skipped
+// when expanding the "..." wildcard.
+// Unlike the go command, build constraints are not evaluated, so every
+// directory containing Go files is a package directory.
+package walk
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Dirs returns the package directories matching the patterns, using the
+// native path syntax.  A pattern is a directory, optionally containing the
+// "..." wildcard.  If no pattern is specified, the current directory is used.
+// The directory tree is walked as specified by opts.
+func Dirs(patterns []string, opts Options) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	dirs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		root, rest := split(pattern)
+		list, err := Match(os.DirFS(root), rest, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range list {
+			dir = filepath.Join(root, filepath.FromSlash(dir))
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	return dirs, nil
+}
+
+// split splits the native pattern in the root directory before the first
+// wildcard and the remaining slash separated pattern, relative to the root.
+func split(pattern string) (root, rest string) {
+	pattern = filepath.Clean(pattern)
+	i := strings.Index(pattern, "...")
+	if i < 0 {
+		return pattern, "."
+	}
+
+	root = filepath.Dir(pattern[:i])
+	rel, err := filepath.Rel(root, pattern)
+	if err != nil {
+		return root, "..."
+	}
+
+	return root, filepath.ToSlash(rel)
+}
+
+// Match returns the directories in fsys matching the slash separated pattern.
+// Without wildcards, the pattern is returned if it is a directory.  Otherwise,
+// the directories containing Go files and matching the pattern are returned,
+// in lexical order.
+//
+// The directory tree is walked as specified by opts.
+func Match(fsys fs.FS, pattern string, opts Options) ([]string, error) {
+	if !strings.Contains(pattern, "...") {
+		fi, err := fs.Stat(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, &fs.PathError{Op: "walk", Path: pattern, Err: errNotDir}
+		}
+
+		return []string{pattern}, nil
+	}
+
+	w := &walker{
+		fsys:  fsys,
+		opts:  opts,
+		match: MatchPattern(pattern),
+		dirs:  make([]string, 0),
+		seen:  make(map[string]bool),
+	}
+	if err := w.walk(".", 0, nil); err != nil {
+		return nil, err
+	}
+
+	return w.dirs, nil
+}
+
+// Options configure how a directory tree is walked.
+type Options struct {
+	// FollowSymlinks enables following the symbolic links to files and
+	// directories.  A link to a directory containing it is skipped, to
+	// avoid cycles; cycles are only detected on the operating system file
+	// system.
+	FollowSymlinks bool
+
+	// MaxDepth is the maximum depth of the walked directories, starting
+	// at 0 for the root of the file system; Dirs uses the directory before
+	// the first wildcard as root.  A negative value means no limit.
+	MaxDepth int
+}
+
+// walker walks a file tree, collecting the directories matching a pattern.
+type walker struct {
+	fsys  fs.FS
+	opts  Options
+	match func(name string) bool // reports whether a directory matches
+	dirs  []string               // matching directories, in lexical order
+	seen  map[string]bool        // directories already in dirs
+}
+
+// walk walks the directory dir at the specified depth in lexical order.  The
+// parents are the directories containing dir, used to detect symbolic link
+// cycles.
+func (w *walker) walk(dir string, depth int, parents []fs.FileInfo) error {
+	entries, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		return err
+	}
+	if w.opts.FollowSymlinks {
+		fi, err := fs.Stat(w.fsys, dir)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, fi)
+	}
+
+	for _, d := range entries {
+		name := path.Join(dir, d.Name())
+		mode := d.Type()
+		if w.opts.FollowSymlinks && mode&fs.ModeSymlink != 0 {
+			fi, err := fs.Stat(w.fsys, name)
+			if err != nil {
+				// Broken link.
+				continue
+			}
+			if fi.IsDir() && cycle(fi, parents) {
+				continue
+			}
+			mode = fi.Mode().Type()
+		}
+		if mode.IsDir() {
+			if skip(d.Name()) || nested(w.fsys, name) {
+				continue
+			}
+			if max := w.opts.MaxDepth; max >= 0 && depth >= max {
+				continue
+			}
+			if err := w.walk(name, depth+1, parents); err != nil {
+				return err
+			}
+
+			continue
+		}
+		if mode.IsRegular() && path.Ext(name) == ".go" && !w.seen[dir] && w.match(dir) {
+			w.seen[dir] = true
+			w.dirs = append(w.dirs, dir)
+		}
+	}
+
+	return nil
+}
+
+// cycle reports whether the directory fi is one of the parents.
+func cycle(fi fs.FileInfo, parents []fs.FileInfo) bool {
+	for _, p := range parents {
+		if os.SameFile(fi, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errNotDir is the error reported when a pattern is not a directory.
+var errNotDir = errors.New("not a directory")
+
+// skip reports whether the directory with the specified name is skipped when
+// expanding a wildcard.
+func skip(name string) bool {
+	return name == "testdata" || name == "vendor" ||
+		strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// nested reports whether the directory is the root of a nested module, having
+// a go.mod file.
+func nested(fsys fs.FS, dir string) bool {
+	fi, err := fs.Stat(fsys, path.Join(dir, "go.mod"))
+
+	return err == nil && !fi.IsDir()
+}
+
+// MatchPattern returns a function reporting whether a slash separated path,
+// like a directory or an import path, matches the pattern.
+func MatchPattern(pattern string) func(name string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+
+	// Special case: foo/... matches foo too.
+	if strings.HasSuffix(re, `/.*`) {
+		re = re[:len(re)-len(`/.*`)] + `(/.*)?`
+	}
+	reg := regexp.MustCompile(`^` + re + `$`)
+
+	return func(name string) bool {
+		return reg.MatchString(name)
+	}
+}
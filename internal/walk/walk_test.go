@@ -0,0 +1,160 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package walk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// TestMatch tests the Match function using an in memory file system.
+func TestMatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":                 {},
+		"foo/a.go":             {},
+		"foo/bar/a.go":         {},
+		"foo/testdata/a.go":    {},
+		"foo/_tmp/a.go":        {},
+		"foo/.git/a.go":        {},
+		"foo/vendor/x/a.go":    {},
+		"foobar/a.go":          {},
+		"foobar/nested/go.mod": {},
+		"foobar/nested/a.go":   {},
+		"doc/README":           {},
+		"testdata/nested/a.go": {},
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"...", []string{".", "foo", "foo/bar", "foobar"}},
+		{"foo/...", []string{"foo", "foo/bar"}},
+		{"foo...", []string{"foo", "foo/bar", "foobar"}},
+		{".../bar", []string{"foo/bar"}},
+		{"doc", []string{"doc"}},
+		{"testdata", []string{"testdata"}},
+	}
+	for _, test := range tests {
+		got, err := Match(fsys, test.pattern, Options{MaxDepth: -1})
+		if err != nil {
+			t.Errorf("Match(%q): %v", test.pattern, err)
+
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Match(%q): want %v, got %v", test.pattern, test.want, got)
+		}
+	}
+
+	if _, err := Match(fsys, "missing", Options{}); err == nil {
+		t.Error("Match(\"missing\"): expected err != nil")
+	}
+	if _, err := Match(fsys, "a.go", Options{}); err == nil {
+		t.Error("Match(\"a.go\"): expected err != nil")
+	}
+}
+
+// TestMatchDepth tests the Match function with a maximum depth.
+func TestMatchDepth(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":             {},
+		"foo/a.go":         {},
+		"foo/bar/a.go":     {},
+		"foo/bar/baz/a.go": {},
+	}
+	tests := []struct {
+		pattern  string
+		maxdepth int
+		want     []string
+	}{
+		{"...", 0, []string{"."}},
+		{"...", 1, []string{".", "foo"}},
+		{"...", 2, []string{".", "foo", "foo/bar"}},
+		{"...", -1, []string{".", "foo", "foo/bar", "foo/bar/baz"}},
+		{"foo/...", 1, []string{"foo"}},
+	}
+	for _, test := range tests {
+		got, err := Match(fsys, test.pattern, Options{MaxDepth: test.maxdepth})
+		if err != nil {
+			t.Errorf("Match(%q, %d): %v", test.pattern, test.maxdepth, err)
+
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Match(%q, %d): want %v, got %v", test.pattern, test.maxdepth, test.want, got)
+		}
+	}
+}
+
+// TestMatchSymlinks tests the Match function with symbolic links, including
+// a cycle.
+func TestMatchSymlinks(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "shared"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "shared", "s.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"a/s.go":   "../shared/s.go",
+		"a/loop":   "..",
+		"b":        "shared",
+		"a/broken": "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		follow bool
+		want   []string
+	}{
+		{false, []string{"shared"}},
+		{true, []string{"a", "b", "shared"}},
+	}
+	for _, test := range tests {
+		got, err := Match(os.DirFS(root), "...", Options{FollowSymlinks: test.follow, MaxDepth: -1})
+		if err != nil {
+			t.Errorf("Match(%v): %v", test.follow, err)
+
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Match(%v): want %v, got %v", test.follow, test.want, got)
+		}
+	}
+}
+
+// TestSplit tests the split function.
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		pattern string
+		root    string
+		rest    string
+	}{
+		{".", ".", "."},
+		{"./...", ".", "..."},
+		{"...", ".", "..."},
+		{"foo/...", "foo", "..."},
+		{"./foo/bar...", "foo", "bar..."},
+		{"foo/.../baz", "foo", ".../baz"},
+		{"foo", "foo", "."},
+	}
+	for _, test := range tests {
+		root, rest := split(test.pattern)
+		if root != test.root || rest != test.rest {
+			t.Errorf("split(%q): want %q, %q, got %q, %q",
+				test.pattern, test.root, test.rest, root, rest)
+		}
+	}
+}
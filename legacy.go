@@ -0,0 +1,66 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// legacypkg is a package with files only having legacy // +build lines.
+type legacypkg struct {
+	Package string   // import path, or directory if not known
+	Files   []string // files without a //go:build line
+}
+
+// legacyfiles returns, for each package in the report, the files that only
+// have legacy // +build lines, without a //go:build counterpart, so that the
+// modules targeting Go 1.17 or later can finish the migration.  The packages
+// without such files are not reported.
+func legacyfiles(report *buildtags.Report) []*legacypkg {
+	list := make([]*legacypkg, 0)
+	for _, p := range filesbypkg(report, legacyonly) {
+		files := make([]string, 0, len(p.Files))
+		for _, file := range p.Files {
+			files = append(files, render(p.Package, file.Name))
+		}
+		list = append(list, &legacypkg{Package: p.Name, Files: files})
+	}
+
+	return list
+}
+
+// legacyonly reports whether file has // +build lines, but no //go:build
+// line.
+func legacyonly(file *buildtags.File) bool {
+	legacy := false
+	for _, c := range file.Constraints {
+		if c.Origin == buildtags.GoBuild {
+			return false
+		}
+		legacy = true
+	}
+
+	return legacy
+}
+
+// printlegacy writes to w, for each package, the number of files only having
+// legacy // +build lines followed by the files.
+func printlegacy(w io.Writer, pkgs []*legacypkg) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "legacy-only:")
+	for _, p := range pkgs {
+		fmt.Fprintf(tw, "\t%s\t%s\n", p.Package, strconv.Itoa(len(p.Files)))
+		for _, name := range p.Files {
+			fmt.Fprintf(tw, "\t\t%s\n", name)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,725 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var listCmd = &command{
+	name:  "list",
+	args:  "[packages]",
+	short: "categorize and show the build tags in the packages",
+	flags: listFlags,
+	run:   runList,
+}
+
+// list command flags.
+var (
+	listFlags  = flag.NewFlagSet("list", flag.ExitOnError)
+	verbose    = listFlags.Bool("v", false, "list the positions where each tag is specified")
+	stdin      = listFlags.Bool("stdin", false, "read a single Go file from stdin, instead of loading packages")
+	filename   = listFlags.String("filename", "stdin.go", "`name` of the Go file read from stdin")
+	assumetags = listFlags.String("assume-tags", "", "treat the comma separated `tags` as satisfied, and only report what still varies")
+	puregoflag = listFlags.Bool("purego", false, "report the files providing the pure Go fallback and the assembly or cgo implementation")
+	hostflag   = listFlags.Bool("host", false, "also report all the tags satisfied by the host build, as reported by go list")
+)
+
+// tagset maps a build tag to the positions where it has been specified, one
+// entry for each occurrence.
+type tagset map[string][]string
+
+func (set tagset) add(tag string, pos buildtags.Position) {
+	loc := pos.File
+	if pos.Line > 0 {
+		loc += ":" + strconv.Itoa(pos.Line)
+	}
+	set[tag] = append(set[tag], loc)
+}
+
+// format writes the tags in set to w, with the specified label.  The tags in
+// testonly are marked as used only in tests.
+func (set tagset) format(w io.Writer, label string, testonly map[string]bool) {
+	list := set.sorted()
+
+	w.Write([]byte(label + ":\n"))
+	for _, tag := range list {
+		locs := set[tag]
+		line := "\t" + tag + "\t" + strconv.Itoa(len(locs))
+		if testonly[tag] {
+			line += "\t(test only)"
+		}
+		if label == string(buildtags.GOOS) || label == string(buildtags.GOARCH) {
+			line += "\t" + portclass(tag)
+		}
+		// The descriptions of the well-known tags are only reported
+		// in verbose mode, to keep the table compact.
+		d := cfg.description(tag)
+		if d == "" && *verbose {
+			d = buildtags.Describe(tag)
+		}
+		if d != "" {
+			line += "\t" + d
+		}
+		w.Write([]byte(line + "\n"))
+		if !*verbose {
+			continue
+		}
+		for _, loc := range locs {
+			w.Write([]byte("\t\t" + loc + "\n"))
+		}
+	}
+}
+
+// Port classes of the GOOS and GOARCH tags.
+const (
+	portFirstClass = "first-class"
+	portSecondary  = "secondary"
+)
+
+// portclass returns the port class of the GOOS or GOARCH tag, so that
+// maintainers can prioritize where platform-specific code needs testing.
+func portclass(tag string) string {
+	if buildtags.FirstClassTag(tag) {
+		return portFirstClass
+	}
+
+	return portSecondary
+}
+
+// portclasses returns the port class of each GOOS and GOARCH tag.
+func portclasses(tags []*buildtags.Tag) map[string]string {
+	m := make(map[string]string)
+	for _, tag := range tags {
+		if tag.Category == buildtags.GOOS || tag.Category == buildtags.GOARCH {
+			m[tag.Name] = portclass(tag.Name)
+		}
+	}
+
+	return m
+}
+
+func (set tagset) sorted() []string {
+	list := make([]string, 0, len(set))
+	for tag := range set {
+		list = append(list, tag)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// runList categorizes and prints all the Go build tags in the specified
+// packages.
+func runList(ctx context.Context, args []string) error {
+	var report *buildtags.Report
+	var err error
+	if *stdin {
+		report, err = readstdin(*filename)
+	} else {
+		report, err = load(ctx, args)
+	}
+	if err != nil {
+		return err
+	}
+	if len(cfg.Aliases) > 0 {
+		collapse(report, cfg.Aliases, cfg.overrides())
+	}
+	if *assumetags != "" {
+		assume(report, set(split(*assumetags)))
+	}
+	if *hostflag {
+		hosttags, err = buildtags.HostTags(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Print the tags.
+	if format == formatJSON {
+		return printjson(os.Stdout, report)
+	}
+	switch {
+	case workspace:
+		// Group the results by workspace module.
+		for _, g := range bymodule(report) {
+			fmt.Printf("module %s:\n", g.Name)
+			if err := printreport(os.Stdout, g.Report); err != nil {
+				return err
+			}
+		}
+	case len(rootflags) > 0:
+		// Group the results by root.
+		for _, g := range byroot(report, rootflags) {
+			fmt.Printf("root %s:\n", g.Name)
+			if err := printreport(os.Stdout, g.Report); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := printreport(os.Stdout, report); err != nil {
+			return err
+		}
+	}
+	if deps {
+		if err := printmodules(os.Stdout, moduletags(report)); err != nil {
+			return err
+		}
+	}
+	if *hostflag {
+		if err := printhost(os.Stdout, hosttags); err != nil {
+			return err
+		}
+	}
+	if tagflag == "" {
+		return nil
+	}
+
+	return printoccurrences(os.Stdout, report)
+}
+
+// hosttags are the tags satisfied by the host build, set by the -host flag.
+var hosttags []string
+
+// hosttag is a tag satisfied by the host build.
+type hosttag struct {
+	Name     string
+	Category buildtags.Category
+}
+
+// newhosttags returns the tags satisfied by the host build, with their
+// category.
+func newhosttags(tags []string) []*hosttag {
+	list := make([]*hosttag, 0, len(tags))
+	for _, tag := range tags {
+		list = append(list, &hosttag{Name: tag, Category: buildtags.Categorize(tag)})
+	}
+
+	return list
+}
+
+// printhost writes to w the tags satisfied by the host build, with their
+// category, as a reference for the tags in the report.
+func printhost(w io.Writer, tags []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "host-tags:")
+	for _, tag := range newhosttags(tags) {
+		fmt.Fprintf(tw, "\t%s\t%s\n", tag.Name, tag.Category)
+	}
+
+	return tw.Flush()
+}
+
+// modtags are the build tags used by the packages of a module.
+type modtags struct {
+	Module string   // module path and version, or std for the standard library
+	Tags   []string // build tags, sorted
+}
+
+// moduletags returns the build tags in the report grouped by module, in the
+// order the modules are first found.
+func moduletags(report *buildtags.Report) []*modtags {
+	index := make(map[string]map[string]bool)
+	order := make([]string, 0)
+	for _, pkg := range report.Packages {
+		mod := "std"
+		if m := pkg.Module; m != nil {
+			mod = m.Path
+			if m.Version != "" {
+				mod += "@" + m.Version
+			}
+		}
+		set, ok := index[mod]
+		if !ok {
+			set = make(map[string]bool)
+			index[mod] = set
+			order = append(order, mod)
+		}
+		for _, file := range pkg.Files {
+			for _, tag := range file.Tags {
+				set[tag.Name] = true
+			}
+		}
+	}
+
+	list := make([]*modtags, 0, len(order))
+	for _, mod := range order {
+		tags := make([]string, 0, len(index[mod]))
+		for tag := range index[mod] {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		list = append(list, &modtags{Module: mod, Tags: tags})
+	}
+
+	return list
+}
+
+// roottags are the build tags used by the packages in a root directory.
+type roottags struct {
+	Root string   // root directory, as specified by the -root flag
+	Tags []string // build tags, sorted
+}
+
+// tagsbyroot returns the build tags in the report grouped by the root
+// directories specified by the -root flag.
+func tagsbyroot(report *buildtags.Report) []*roottags {
+	groups := byroot(report, rootflags)
+	list := make([]*roottags, 0, len(groups))
+	for _, g := range groups {
+		tags := make([]string, 0)
+		for _, tag := range g.Report.Tags() {
+			tags = append(tags, tag.Name)
+		}
+		sort.Strings(tags)
+		list = append(list, &roottags{Root: g.Name, Tags: tags})
+	}
+
+	return list
+}
+
+// printmodules writes to w the build tags used by each module.
+func printmodules(w io.Writer, list []*modtags) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "modules:")
+	for _, m := range list {
+		fmt.Fprintf(tw, "\t%s\t%s\n", m.Module, strings.Join(m.Tags, ","))
+	}
+
+	return tw.Flush()
+}
+
+// printoccurrences writes to w each occurrence of the tags in the report,
+// with the constraint expression containing it.
+func printoccurrences(w io.Writer, report *buildtags.Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "occurrences:")
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			exprs := make(map[int]string)
+			for _, c := range file.Constraints {
+				exprs[c.Line] = c.Expr.String()
+			}
+			for _, tag := range file.Tags {
+				for _, pos := range tag.Positions {
+					loc := pos.File
+					expr := "file name"
+					if pos.Line > 0 {
+						loc += ":" + strconv.Itoa(pos.Line)
+						expr = exprs[pos.Line]
+					}
+					fmt.Fprintf(tw, "\t%s\t%s\t%s\n", loc, tag.Name, expr)
+				}
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+// printreport writes to w the tags in the report grouped by category, the
+// ignored, header, standalone, cgo, cgo-only, compiler-specific, fuzzing,
+// legacy-only and excluded files and, in a separate section, the tags in the
+// testdata directories.
+func printreport(w io.Writer, report *buildtags.Report) error {
+	code, testdata := splittestdata(report)
+	if err := printtext(w, sources(code).Tags()); err != nil {
+		return err
+	}
+	if err := printignored(w, ignoredfiles(report)); err != nil {
+		return err
+	}
+	if err := printother(w, otherfiles(report)); err != nil {
+		return err
+	}
+	if err := printstandalone(w, standalonefiles(report)); err != nil {
+		return err
+	}
+	if err := printcgo(w, cgofiles(report)); err != nil {
+		return err
+	}
+	if err := printcgoonly(w, cgoonlyfiles(report)); err != nil {
+		return err
+	}
+	if err := printcompiler(w, compilerfiles(report)); err != nil {
+		return err
+	}
+	if err := printfuzz(w, fuzzfiles(report)); err != nil {
+		return err
+	}
+	if err := printlegacy(w, legacyfiles(report)); err != nil {
+		return err
+	}
+	if err := printexcluded(w, excludedfiles(report)); err != nil {
+		return err
+	}
+	if *puregoflag {
+		if err := printpurego(w, puregofiles(report)); err != nil {
+			return err
+		}
+	}
+	if *assumetags != "" {
+		err := printresiduals(w, residuals(report, set(split(*assumetags))))
+		if err != nil {
+			return err
+		}
+	}
+	if len(testdata.Packages) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "testdata:")
+
+	return printtext(w, sources(testdata).Tags())
+}
+
+// splittestdata splits the report in the packages outside and inside a
+// testdata directory, when the -include-testdata flag is set.
+func splittestdata(report *buildtags.Report) (code, testdata *buildtags.Report) {
+	code = &buildtags.Report{Packages: make([]*buildtags.Package, 0)}
+	testdata = &buildtags.Report{Packages: make([]*buildtags.Package, 0)}
+	for _, pkg := range report.Packages {
+		if includetestdata && intestdata(pkg.Dir) {
+			testdata.Packages = append(testdata.Packages, pkg)
+		} else {
+			code.Packages = append(code.Packages, pkg)
+		}
+	}
+
+	return code, testdata
+}
+
+// sources returns a report with the files in the report, except the C and
+// C++ header files, whose tags are reported separately.
+func sources(report *buildtags.Report) *buildtags.Report {
+	r := &buildtags.Report{Packages: make([]*buildtags.Package, 0, len(report.Packages))}
+	for _, pkg := range report.Packages {
+		p := *pkg
+		p.Files = make([]*buildtags.File, 0, len(pkg.Files))
+		for _, file := range pkg.Files {
+			if !file.Header() {
+				p.Files = append(p.Files, file)
+			}
+		}
+		r.Packages = append(r.Packages, &p)
+	}
+
+	return r
+}
+
+// otherfiles returns the C and C++ header files in the report, with their
+// build tags.
+func otherfiles(report *buildtags.Report) []*ignoredfile {
+	list := make([]*ignoredfile, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			if file.Header() {
+				list = append(list, newignoredfile(pkg, file))
+			}
+		}
+	}
+
+	return list
+}
+
+// printother writes to w the header files, with their build tags, in a
+// dedicated section, since they are not compiled on their own.
+func printother(w io.Writer, files []*ignoredfile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "other-file:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, strings.Join(f.Tags, ","))
+	}
+
+	return tw.Flush()
+}
+
+// standalonefiles returns the paths of the standalone programs in the report,
+// like code generators, excluded from their package by //go:build ignore.
+func standalonefiles(report *buildtags.Report) []string {
+	list := make([]string, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			if file.Standalone() {
+				list = append(list, render(pkg, file.Name))
+			}
+		}
+	}
+
+	return list
+}
+
+// printstandalone writes to w the standalone programs, in a dedicated section.
+func printstandalone(w io.Writer, files []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "standalone-file:")
+	for _, name := range files {
+		fmt.Fprintf(tw, "\t%s\n", name)
+	}
+
+	return tw.Flush()
+}
+
+// cgofile is a Go file importing "C".
+type cgofile struct {
+	File string // file path
+	Expr string `json:",omitempty"` // constraint expression, empty if none
+}
+
+// cgofiles returns the Go files in the report using cgo, with the constraint
+// gating them, including the file name tags.  The files not reported are pure
+// Go.
+func cgofiles(report *buildtags.Report) []*cgofile {
+	list := make([]*cgofile, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			if !file.Cgo {
+				continue
+			}
+			f := &cgofile{File: render(pkg, file.Name)}
+			if x := effective(file); x != nil {
+				f.Expr = x.String()
+			}
+			list = append(list, f)
+		}
+	}
+
+	return list
+}
+
+// printcgo writes to w the Go files using cgo, with the constraint gating
+// them.  A file without constraints always uses cgo.
+func printcgo(w io.Writer, files []*cgofile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "cgo-file:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, f.Expr)
+	}
+
+	return tw.Flush()
+}
+
+// excludedfile is a file excluded by the build context of go list.
+type excludedfile struct {
+	File string // file path
+	Expr string `json:",omitempty"` // constraint expression, for scanned files
+}
+
+// excludedfiles returns the files in the report excluded by the host build
+// context, as reported by go list in IgnoredGoFiles and IgnoredOtherFiles.
+// Files ignored by the go command are not included.
+func excludedfiles(report *buildtags.Report) []*excludedfile {
+	list := make([]*excludedfile, 0)
+	for _, pkg := range report.Packages {
+		exprs := make(map[string]string)
+		for _, file := range pkg.Files {
+			exprs[file.Name] = ""
+			if x := file.Expr(); x != nil {
+				exprs[file.Name] = x.String()
+			}
+		}
+		for _, name := range pkg.IgnoredGoFiles {
+			if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+				continue
+			}
+			// With the -tag flag, only the files containing the tags
+			// are reported.
+			if _, ok := exprs[name]; !ok && tagflag != "" {
+				continue
+			}
+			list = append(list, &excludedfile{File: render(pkg, name), Expr: exprs[name]})
+		}
+		if tagflag != "" {
+			continue
+		}
+		for _, name := range pkg.IgnoredOtherFiles {
+			list = append(list, &excludedfile{File: render(pkg, name), Expr: exprs[name]})
+		}
+	}
+
+	return list
+}
+
+// printexcluded writes to w the files excluded by the host build context, with
+// their constraint expression.
+func printexcluded(w io.Writer, files []*excludedfile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "excluded-file:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, f.Expr)
+	}
+
+	return tw.Flush()
+}
+
+// ignoredfile is a file reported with its build tags in a dedicated section,
+// like a Go file ignored by the go command, whose name starts with "_" or ".".
+type ignoredfile struct {
+	File string   // file path
+	Tags []string // build tags in the file
+}
+
+// newignoredfile returns the ignoredfile for the file in pkg.
+func newignoredfile(pkg *buildtags.Package, file *buildtags.File) *ignoredfile {
+	f := &ignoredfile{
+		File: render(pkg, file.Name),
+		Tags: make([]string, 0, len(file.Tags)),
+	}
+	for _, tag := range file.Tags {
+		f.Tags = append(f.Tags, tag.Name)
+	}
+
+	return f
+}
+
+// ignoredfiles returns the files in the report ignored by the go command.
+func ignoredfiles(report *buildtags.Report) []*ignoredfile {
+	list := make([]*ignoredfile, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			if file.Ignored() {
+				list = append(list, newignoredfile(pkg, file))
+			}
+		}
+	}
+
+	return list
+}
+
+// printignored writes to w the ignored files, with their build tags, in a
+// dedicated section, since stale platform files often hide there.
+func printignored(w io.Writer, files []*ignoredfile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "ignored-file:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, strings.Join(f.Tags, ","))
+	}
+
+	return tw.Flush()
+}
+
+// printtext writes to w the tags grouped by category, as a table.
+func printtext(w io.Writer, tags []*buildtags.Tag) error {
+	sets := make(map[buildtags.Category]tagset)
+	for _, c := range cfg.categories() {
+		sets[c] = make(tagset)
+	}
+	testonly := make(map[string]bool)
+	for _, tag := range tags {
+		set := sets[cfg.known(tag.Category)]
+		for _, pos := range tag.Positions {
+			set.add(tag.Name, pos)
+		}
+		testonly[tag.Name] = tag.TestOnly
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	selected, _ := categories()
+	for _, c := range selected {
+		sets[c].format(tw, string(c), testonly)
+	}
+
+	return tw.Flush()
+}
+
+// readstdin returns a report with a single Go file, read from stdin.  The
+// name is used as the file name, and the tags in the name are reported, but
+// the file system is never accessed.
+func readstdin(name string) (*buildtags.Report, error) {
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	file, err := buildtags.ParseFile(name, src)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &buildtags.Package{
+		Dir:   filepath.Dir(name),
+		Files: []*buildtags.File{file},
+	}
+
+	return &buildtags.Report{Packages: []*buildtags.Package{pkg}}, nil
+}
+
+// printjson writes to w the packages in the report and all the tags as a JSON
+// object.  The tags in the testdata directories are reported separately.
+func printjson(w io.Writer, report *buildtags.Report) error {
+	code, testdata := splittestdata(report)
+	out := struct {
+		Packages      []*buildtags.Package
+		Tags          []*buildtags.Tag
+		TestdataTags  []*buildtags.Tag `json:",omitempty"`
+		IgnoredFiles  []*ignoredfile
+		OtherFiles    []*ignoredfile
+		Standalone    []string
+		CgoFiles      []*cgofile
+		CgoOnly       []*cgoonlypkg
+		CompilerFiles []*compilerfile
+		FuzzFiles     []*fuzzfile
+		LegacyOnly    []*legacypkg
+		ExcludedFiles []*excludedfile
+		Modules       []*modtags        `json:",omitempty"`
+		Roots         []*roottags       `json:",omitempty"`
+		Residuals     []*residual       `json:",omitempty"`
+		Purego        []*puregofile     `json:",omitempty"`
+		HostTags      []*hosttag        `json:",omitempty"`
+		Descriptions  map[string]string `json:",omitempty"`
+		PortClasses   map[string]string
+	}{
+		Packages:      report.Packages,
+		Tags:          sources(code).Tags(),
+		TestdataTags:  sources(testdata).Tags(),
+		IgnoredFiles:  ignoredfiles(report),
+		OtherFiles:    otherfiles(report),
+		Standalone:    standalonefiles(report),
+		CgoFiles:      cgofiles(report),
+		CgoOnly:       cgoonlyfiles(report),
+		CompilerFiles: compilerfiles(report),
+		FuzzFiles:     fuzzfiles(report),
+		LegacyOnly:    legacyfiles(report),
+		ExcludedFiles: excludedfiles(report),
+		PortClasses:   portclasses(report.Tags()),
+	}
+	if deps || workspace {
+		out.Modules = moduletags(report)
+	}
+	if len(rootflags) > 0 {
+		out.Roots = tagsbyroot(report)
+	}
+	if *assumetags != "" {
+		out.Residuals = residuals(report, set(split(*assumetags)))
+	}
+	if *puregoflag {
+		out.Purego = puregofiles(report)
+	}
+	if *hostflag {
+		out.HostTags = newhosttags(hosttags)
+	}
+	for tag, known := range cfg.Tags {
+		if known.Description == "" {
+			continue
+		}
+		if out.Descriptions == nil {
+			out.Descriptions = make(map[string]string)
+		}
+		out.Descriptions[tag] = known.Description
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(out)
+}
@@ -2,371 +2,843 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// The code for the parsename function has been adapted from the goodOSArchFile
-// method from src/go/build/build.go in the Go source distribution.
-// Copyright 2011 The Go Authors. All rights reserved.
-
 // go-buildtags parses, categories and shows all build tags in a package.
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"go/build/constraint"
-	"go/parser"
-	"go/token"
-	"io"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
-	"sort"
-	"strconv"
+	"runtime"
 	"strings"
-	"text/tabwriter"
 
+	"github.com/perillo/go-buildtags/buildtags"
 	"github.com/perillo/go-buildtags/internal/invoke"
+	"github.com/perillo/go-buildtags/internal/walk"
 )
 
-const usage = "Usage: go-buildtags [packages]"
+const usage = `Usage: go-buildtags [command] [flags] [packages]
+
+The commands are:
+`
+
+// Output formats, as specified by the -format flag.
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatMarkdown = "markdown" // only supported by render
+)
 
-// gocmd is the go command to use.  It can be overridden using the GOCMD
-// environment variable.
-var gocmd = "go"
+// Path rendering modes, as specified by the -path flag.
+const (
+	pathRel    = "rel"    // relative to the module root
+	pathAbs    = "abs"    // absolute
+	pathImport = "import" // import path and file name
+)
+
+// Test files modes, as specified by the -tests flag.
+const (
+	testsInclude = "true"  // scan test files
+	testsExclude = "false" // do not scan test files
+	testsOnly    = "only"  // only scan test files
+)
 
-// List of past, present and future known GOOS and GOARCH values.
-// Taken from cmd/go/internal/imports/build.go in the Go distribution.
+// Shared command line flags.
 var (
-	knownOS = map[string]bool{
-		"aix":       true,
-		"android":   true,
-		"darwin":    true,
-		"dragonfly": true,
-		"freebsd":   true,
-		"hurd":      true,
-		"illumos":   true,
-		"ios":       true,
-		"js":        true,
-		"linux":     true,
-		"nacl":      true,
-		"netbsd":    true,
-		"openbsd":   true,
-		"plan9":     true,
-		"solaris":   true,
-		"windows":   true,
-		"zos":       true,
-	}
-
-	knownArch = map[string]bool{
-		"386":         true,
-		"amd64":       true,
-		"amd64p32":    true,
-		"arm":         true,
-		"armbe":       true,
-		"arm64":       true,
-		"arm64be":     true,
-		"mips":        true,
-		"mipsle":      true,
-		"mips64":      true,
-		"mips64le":    true,
-		"mips64p32":   true,
-		"mips64p32le": true,
-		"ppc":         true,
-		"ppc64":       true,
-		"ppc64le":     true,
-		"riscv":       true,
-		"riscv64":     true,
-		"s390":        true,
-		"s390x":       true,
-		"sparc":       true,
-		"sparc64":     true,
-		"wasm":        true,
-	}
+	format          string
+	pathmode        string
+	dirmode         bool
+	tests           string
+	skipgen         bool
+	vendor          bool
+	includetestdata bool
+	catflag         string
+	hideflag        string
+	specialflag     string
+	tagflag         string
+	matchflag       string
+	deps            bool
+	module          bool
+	workspace       bool
+	symlinks        bool
+	mainonly        bool
+	rootflags       stringsFlag
+	excludes        stringsFlag
+	excludepkgs     stringsFlag
+	modflag         string
+	modfile         string
+	overlayflag     string
+	distlist        bool
+	goosflag        string
+	goarchflag      string
+	maxdepth        int
+	offset          int
+	limit           int
 )
 
-// List of past, present and future known release tags.
-var knownReleaseTag = map[string]bool{
-	"go1": true,
+// command is a go-buildtags subcommand.
+type command struct {
+	name  string        // command name
+	args  string        // arguments, as shown in the usage line
+	short string        // short description
+	flags *flag.FlagSet // command flags, including the shared flags
+	run   func(ctx context.Context, args []string) error
 }
 
-// List of know special build tags.
-var knownSpecialTag = map[string]bool{
-	"cgo":   true,
-	"gc":    true,
-	"gccgo": true,
+// commands is the list of all the subcommands.  The first command is the
+// default.
+var commands []*command
+
+func init() {
+	if value := os.Getenv("GOCMD"); value != "" {
+		buildtags.GoCmd = value
+	}
 
-	// TODO(mperillo): Add msan and race to knownSpecialTag?
+	commands = []*command{
+		listCmd,
+		checkCmd,
+		fixCmd,
+		matrixCmd,
+		filesCmd,
+		whyCmd,
+		renameCmd,
+		statsCmd,
+		diffCmd,
+		docCmd,
+		renderCmd,
+		simplifyCmd,
+	}
+	def := buildtags.DefaultContext()
+	for _, cmd := range commands {
+		cmd.flags.StringVar(&goosflag, "goos", def.GOOS, "target operating system, passed to go list and used to evaluate the constraints")
+		cmd.flags.StringVar(&goarchflag, "goarch", def.GOARCH, "target architecture, passed to go list and used to evaluate the constraints")
+		cmd.flags.StringVar(&format, "format", formatText, "output format: text or json, or markdown for render")
+		cmd.flags.StringVar(&pathmode, "path", pathRel, "how files are identified: rel, abs or import")
+		cmd.flags.StringVar(&modflag, "mod", "", "module download mode passed to go list: readonly, vendor or mod")
+		cmd.flags.StringVar(&modfile, "modfile", "", "alternate go.mod `file` passed to go list")
+		cmd.flags.BoolVar(&distlist, "dist-list", false, "discover the known GOOS and GOARCH values with go tool dist list")
+		cmd.flags.StringVar(&overlayflag, "overlay", "", "JSON `file` replacing the source files, as defined by the go command -overlay flag")
+		cmd.flags.StringVar(&tests, "tests", testsInclude, "whether _test.go files are scanned: true, false or only")
+		cmd.flags.BoolVar(&skipgen, "skip-generated", false, "skip the generated files, marked with a \"Code generated ... DO NOT EDIT.\" line")
+		cmd.flags.Var(&excludes, "exclude", "skip the files matching the glob `pattern`, like internal/legacy/** (can be repeated)")
+		cmd.flags.Var(&excludepkgs, "exclude-pkg", "skip the packages whose import path matches the `pattern`, like example.com/legacy/... (can be repeated)")
+		cmd.flags.StringVar(&catflag, "categories", "", "comma separated list of the categories to report: goos, goarch, march-level, release, compiler, special, stdlib, goexperiment, convention, fuzz or build (default all)")
+		cmd.flags.StringVar(&hideflag, "hide", "", "comma separated list of the categories not to report, like goos,goarch,release")
+		cmd.flags.StringVar(&matchflag, "match", "", "only scan the files whose name matches the `pattern`, like net_*.go")
+		cmd.flags.StringVar(&specialflag, "special", "", "comma separated list of the tags to report as special tags, like organization-specific toolchain tags")
+		cmd.flags.StringVar(&tagflag, "tag", "", "comma separated list of the only tags to report, and of the files containing them")
+		cmd.flags.BoolVar(&includetestdata, "include-testdata", false, "also scan the packages in the testdata directories")
+		cmd.flags.BoolVar(&module, "module", false, "scan all the packages of the module containing the current directory")
+		cmd.flags.BoolVar(&symlinks, "follow-symlinks", false, "follow symbolic links to Go files and, with -dir, to directories")
+		cmd.flags.Var(&rootflags, "root", "load the packages relative to the module root `dir`, merging the results (can be repeated)")
+		cmd.flags.BoolVar(&mainonly, "main-only", false, "only scan the main packages")
+		cmd.flags.BoolVar(&workspace, "workspace", false, "scan all the packages of the modules in the go.work workspace")
+		cmd.flags.BoolVar(&deps, "deps", false, "also scan the transitive dependencies of the packages")
+		cmd.flags.BoolVar(&vendor, "include-vendor", false, "also scan the packages in the vendor directory")
+		cmd.flags.BoolVar(&dirmode, "dir", false, "scan directory trees directly, without using the go command")
+		cmd.flags.IntVar(&offset, "offset", 0, "skip the first `n` packages, for paginating large reports")
+		cmd.flags.IntVar(&limit, "limit", 0, "scan at most `n` packages, for paginating large reports (0 for no limit)")
+		cmd.flags.IntVar(&maxdepth, "maxdepth", -1, "with -dir, the maximum depth of the directories matched by the ... wildcard (-1 for no limit)")
+		cmd.flags.Usage = cmd.usage
+	}
 }
 
-type tagset map[string]int
+func main() {
+	// Setup log.
+	log.SetFlags(0)
 
-func (set tagset) add(tag string) {
-	set[tag] = set[tag] + 1
-}
+	// Parse command line.
+	args := os.Args[1:]
+	cmd := commands[0]
+	if len(args) > 0 {
+		switch name := args[0]; name {
+		case "help", "-h", "-help", "--help":
+			help(args[1:])
+
+			return
+		default:
+			if c := lookup(name); c != nil {
+				cmd = c
+				args = args[1:]
+			}
+		}
+	}
 
-func (set tagset) addn(tag string, n int) {
-	set[tag] = n
-}
+	// Load the configuration file.  The default flags are parsed first, so
+	// that they can be overridden on the command line.
+	c, err := loadconfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg = c
+	args = parseflags(cmd.flags, append(cfg.Flags[cmd.name], args...))
+
+	switch format {
+	case formatText, formatJSON:
+	case formatMarkdown:
+		if cmd != renderCmd {
+			log.Fatalf("-format=%s is only supported by the render command", format)
+		}
+	default:
+		log.Fatalf("invalid -format value: %q", format)
+	}
+	switch pathmode {
+	case pathRel, pathAbs, pathImport:
+	default:
+		log.Fatalf("invalid -path value: %q", pathmode)
+	}
+
+	switch tests {
+	case testsInclude, testsExclude, testsOnly:
+	default:
+		log.Fatalf("invalid -tests value: %q", tests)
+	}
+	if _, err := categories(); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := path.Match(matchflag, ""); err != nil {
+		log.Fatalf("invalid -match pattern: %q", matchflag)
+	}
+	for _, pattern := range excludes {
+		if !validglob(pattern) {
+			log.Fatalf("invalid -exclude pattern: %q", pattern)
+		}
+	}
+	if offset < 0 || limit < 0 {
+		log.Fatal("-offset and -limit can not be negative")
+	}
+	if maxdepth >= 0 && !dirmode {
+		log.Fatal("-maxdepth requires -dir")
+	}
+	if len(excludepkgs) > 0 && dirmode {
+		log.Fatal("-exclude-pkg can not be used with -dir")
+	}
+	if mainonly && dirmode {
+		log.Fatal("-main-only can not be used with -dir")
+	}
+	if module && workspace {
+		log.Fatal("-module can not be used with -workspace")
+	}
+	if len(rootflags) > 0 && (module || workspace) {
+		log.Fatal("-root can not be used with -module or -workspace")
+	}
+	if deps {
+		if dirmode {
+			log.Fatal("-deps can not be used with -dir")
+		}
+		buildtags.GoFlags = append(buildtags.GoFlags, "-deps")
+	}
+	// Only the -goos and -goarch flags set explicitly override the go
+	// command environment, that may have been changed with go env -w.
+	cmd.flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "goos":
+			buildtags.GoEnv = append(buildtags.GoEnv, "GOOS="+goosflag)
+		case "goarch":
+			buildtags.GoEnv = append(buildtags.GoEnv, "GOARCH="+goarchflag)
+		}
+	})
+	if modflag != "" {
+		buildtags.GoFlags = append(buildtags.GoFlags, "-mod="+modflag)
+	}
+	if modfile != "" {
+		buildtags.GoFlags = append(buildtags.GoFlags, "-modfile="+modfile)
+	}
+	if overlayflag != "" {
+		replace, err := readoverlay(overlayflag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		overlay = replace
+		buildtags.GoFlags = append(buildtags.GoFlags, "-overlay="+overlayflag)
+	}
+	cfg.special = split(specialflag)
 
-func (set tagset) format(w io.Writer, label string) {
-	list := set.sorted()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	w.Write([]byte(label + ":\n"))
-	for _, tag := range list {
-		n := set[tag]
-		w.Write([]byte("\t" + tag + "\t" + strconv.Itoa(n) + "\n"))
+	if distlist {
+		ports, err := buildtags.DistList(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		buildtags.UsePorts(ports)
+	}
+
+	if err := cmd.run(ctx, args); err != nil {
+		log.Fatal(err)
 	}
 }
 
-func (set tagset) sorted() []string {
-	list := make([]string, 0, len(set))
-	for tag := range set {
-		list = append(list, tag)
+// parseflags parses the command line flags in args, returning the non-flag
+// arguments.  Unlike flag.FlagSet.Parse, flags can be specified after the
+// non-flag arguments, as in "go-buildtags why file.go -goos=darwin".  The
+// terminator "--" stops the parsing.
+func parseflags(fs *flag.FlagSet, args []string) []string {
+	list := make([]string, 0)
+	for len(args) > 0 {
+		fs.Parse(args)
+		n := len(args) - fs.NArg() // number of consumed arguments
+		if n > 0 && args[n-1] == "--" {
+			return append(list, fs.Args()...)
+		}
+		args = fs.Args()
+		if len(args) > 0 {
+			list = append(list, args[0])
+			args = args[1:]
+		}
 	}
-	sort.Strings(list)
 
 	return list
 }
 
-func init() {
-	if value := os.Getenv("GOCMD"); value != "" {
-		gocmd = value
+// lookup returns the named command, or nil if not found.
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
 
-	// Add all possible release tags.
-	for i := 1; i < 256; i++ {
-		knownReleaseTag["go1."+strconv.Itoa(i)] = true
-	}
+	return nil
 }
 
-func main() {
-	// Setup log.
-	log.SetFlags(0)
+// help prints the usage of the command named in args, or the list of commands.
+func help(args []string) {
+	if len(args) > 0 {
+		if cmd := lookup(args[0]); cmd != nil {
+			cmd.usage()
 
-	// Parse command line.
-	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, usage)
+			return
+		}
 	}
-	flag.Parse()
-	args := flag.Args()
 
-	directories, err := golist(args)
-	if err != nil {
-		log.Fatal(err)
+	fmt.Fprint(os.Stderr, usage)
+	for i, cmd := range commands {
+		short := cmd.short
+		if i == 0 {
+			short += " (default)"
+		}
+		fmt.Fprintf(os.Stderr, "\t%-8s %s\n", cmd.name, short)
 	}
+	fmt.Fprintln(os.Stderr, "\nUse \"go-buildtags help <command>\" for more information about a command.")
+}
 
-	if err := run(directories); err != nil {
-		log.Fatal(err)
+// usage prints the command usage.
+func (cmd *command) usage() {
+	line := "go-buildtags " + cmd.name + " [flags]"
+	if cmd.args != "" {
+		line += " " + cmd.args
 	}
+	fmt.Fprintf(os.Stderr, "Usage: %s\n\n%s.\n\n", line, strings.ToUpper(cmd.short[:1])+cmd.short[1:])
+	cmd.flags.PrintDefaults()
 }
 
-// run categorizes and prints all the Go build tags in the specified package
-// directories.
-func run(directories []string) error {
-	// Parse the tags.
-	tags := make(tagset)
-	for _, dir := range directories {
-		gofiles, err := readdir(dir)
+// load loads the packages named by the given patterns and scans their build
+// tags.  The file paths in the tag positions are rendered as specified by the
+// -path flag.
+//
+// When the -dir flag is set, the patterns are expanded and scanned directly,
+// without using the go command.  When the -module or -workspace flag is set,
+// all the packages of the current module or of the workspace modules are
+// loaded.  When the -root flag is set, the patterns are loaded relative to
+// each root, ./... by default, and the results are merged.
+func load(ctx context.Context, patterns []string) (*buildtags.Report, error) {
+	if module {
+		if len(patterns) > 0 {
+			return nil, errors.New("-module can not be used with packages")
+		}
+		root, err := modroot()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for _, name := range gofiles {
-			if err := parse(tags, dir, name); err != nil {
-				return err
+		// With -dir, files are rendered relative to the current
+		// directory, so the root must be relative too.
+		if dirmode {
+			if root, err = relcwd(root); err != nil {
+				return nil, err
 			}
 		}
+		patterns = []string{filepath.Join(root, "...")}
+	}
+	var modules []*buildtags.Module
+	if workspace {
+		if len(patterns) > 0 {
+			return nil, errors.New("-workspace can not be used with packages")
+		}
+		list, err := workmodules(ctx)
+		if err != nil {
+			return nil, err
+		}
+		modules = list
+		if patterns, err = workpatterns(modules); err != nil {
+			return nil, err
+		}
+	}
+	var packages []*buildtags.Package
+	roots := make([]string, 0)
+	dirs := []string{""}
+	if len(rootflags) > 0 {
+		if len(patterns) == 0 {
+			patterns = []string{"./..."}
+		}
+		dirs = rootflags
+	}
+	for _, dir := range dirs {
+		list, modroots, err := loadpackages(ctx, dir, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if dirmode {
+			if err := attribute(list, modules); err != nil {
+				return nil, err
+			}
+		}
+		packages = append(packages, list...)
+		roots = append(roots, modroots...)
+	}
+	if includetestdata {
+		list, err := testdatapackages(packages)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, list...)
+	}
+	if vendor {
+		list, err := vendored(roots)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, list...)
+	}
+	if len(excludepkgs) > 0 {
+		packages = excludepackages(packages, excludepkgs)
+	}
+	packages = dedup(packages)
+	packages = paginate(packages, offset, limit)
+	// The ignored and excluded files are never read, so that a malformed
+	// file can be skipped.
+	keep := func(path string) bool {
+		return !cfg.ignored(path) && !excluded(".", excludes, path)
+	}
+	report, err := newscanner(buildtags.WithFileFilter(keep)).ScanPackages(ctx, packages)
+	if err != nil {
+		return nil, err
 	}
 
-	// Categorize the tags.
-	goos := make(tagset)
-	goarch := make(tagset)
-	release := make(tagset)
-	special := make(tagset)
-	build := make(tagset)
-	for tag, n := range tags {
-		switch {
-		case knownOS[tag]:
-			goos.addn(tag, n)
-		case knownArch[tag]:
-			goarch.addn(tag, n)
-		case knownReleaseTag[tag]:
-			release.addn(tag, n)
-		case knownSpecialTag[tag]:
-			special.addn(tag, n)
-		default:
-			build.addn(tag, n)
+	// Restrict the report to the tags specified by the -tag flag and render
+	// the file paths.
+	selected := set(split(tagflag))
+	for _, pkg := range report.Packages {
+		files := pkg.Files[:0]
+		for _, file := range pkg.Files {
+			if len(selected) > 0 && !selecttags(file, selected) {
+				continue
+			}
+			files = append(files, file)
+		}
+		pkg.Files = files
+		for _, file := range pkg.Files {
+			path := render(pkg, file.Name)
+			for _, tag := range file.Tags {
+				for i := range tag.Positions {
+					tag.Positions[i].File = path
+				}
+			}
 		}
 	}
 
-	// Print the tags.
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
-	goos.format(w, "GOOS")
-	goarch.format(w, "GOARCH")
-	release.format(w, "release-tag")
-	special.format(w, "special-tag")
-	build.format(w, "build-tag")
-	w.Flush()
+	return report, nil
+}
 
-	return nil
+// paginate returns at most limit packages, skipping the first offset
+// packages.  A limit of 0 means no limit.
+func paginate(packages []*buildtags.Package, offset, limit int) []*buildtags.Package {
+	if offset >= len(packages) {
+		return packages[:0]
+	}
+	packages = packages[offset:]
+	if limit > 0 && limit < len(packages) {
+		packages = packages[:limit]
+	}
+
+	return packages
 }
 
-// readdir returns a list of all Go files in the specified package directory.
-func readdir(dir string) ([]string, error) {
-	list := make([]string, 0)
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
+// walkoptions returns the options for walking the directory trees with the
+// -dir flag.
+func walkoptions() walk.Options {
+	return walk.Options{
+		FollowSymlinks: symlinks,
+		MaxDepth:       maxdepth,
 	}
-	for _, file := range files {
-		name := file.Name()
-		if file.Type() == 0 && filepath.Ext(name) == ".go" {
-			list = append(list, name)
+}
+
+// dedup returns the packages removing the ones whose directory has already
+// been seen, like when the same directory is matched by multiple patterns or
+// roots, so that it is scanned only once.  Directories are compared using the
+// absolute path, with symbolic links evaluated.
+func dedup(packages []*buildtags.Package) []*buildtags.Package {
+	list := make([]*buildtags.Package, 0, len(packages))
+	seen := make(map[string]bool)
+	for _, pkg := range packages {
+		dir := resolve(pkg.Dir)
+		if seen[dir] {
+			continue
 		}
+		seen[dir] = true
+		list = append(list, pkg)
 	}
 
-	return list, nil
+	return list
 }
 
-// parsename returns the tags specified in the Go file name.
-func parsename(name string) (tags [2]string) {
-	// Strip the file extension.
-	if dot := strings.Index(name, "."); dot != -1 {
-		name = name[:dot]
+// resolve returns the absolute path of dir, with symbolic links evaluated, or
+// dir itself in case of errors.
+func resolve(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	if path, err := filepath.EvalSymlinks(abs); err == nil {
+		return path
 	}
 
-	// Skip normal files.
-	i := strings.Index(name, "_")
-	if i < 0 {
-		return tags
+	return abs
+}
+
+// loadpackages returns the packages named by the given patterns, relative to
+// dir, and the root directories of the modules containing them.  If dir is
+// empty, the current directory is used.  When the -main-only flag is set,
+// only the main packages are loaded, with their dependencies if the -deps flag
+// is set.
+func loadpackages(ctx context.Context, dir string, patterns []string) ([]*buildtags.Package, []string, error) {
+	if mainonly {
+		list, err := mainpackages(ctx, dir, patterns)
+		if err != nil {
+			return nil, nil, err
+		}
+		patterns = list
 	}
 
-	l := strings.Split(name[i+1:], "_")
-	if n := len(l); n > 0 && l[n-1] == "test" {
-		l = l[:n-1]
+	packages := make([]*buildtags.Package, 0)
+	roots := make([]string, 0)
+	if dirmode {
+		// Files are rendered relative to the current directory, so the
+		// patterns are joined to dir.
+		if dir != "" {
+			list := make([]string, 0, len(patterns))
+			for _, pattern := range patterns {
+				list = append(list, filepath.Join(dir, pattern))
+			}
+			patterns = list
+		}
+		dirs, err := walk.Dirs(patterns, walkoptions())
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, dir := range dirs {
+			packages = append(packages, &buildtags.Package{Dir: dir})
+		}
+		roots = append(roots, ".")
+
+		return packages, roots, nil
 	}
-	n := len(l)
 
-	if n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]] {
-		return [2]string{l[n-1], l[n-2]}
+	list, err := buildtags.LoadDir(ctx, dir, patterns)
+	if err != nil {
+		return nil, nil, err
 	}
-	if n >= 1 && (knownOS[l[n-1]] || knownArch[l[n-1]]) {
-		return [2]string{l[n-1]}
+	packages = list
+	for _, pkg := range packages {
+		if pkg.Module != nil && pkg.Module.Dir != "" {
+			roots = append(roots, pkg.Module.Dir)
+		}
 	}
 
-	return tags
+	return packages, roots, nil
 }
 
-// parseheader returns the named Go file header, from the start of the file
-// until the start of the package statement.
-func parseheader(path string) ([]byte, error) {
-	// We use go/parser for convenience.
-	const mode = parser.PackageClauseOnly | parser.ParseComments
-
-	src, err := os.ReadFile(path)
+// modroot returns the root directory of the module containing the current
+// directory, having a go.mod file.
+func modroot() (string, error) {
+	dir, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("parseheader: %v", err)
+		return "", err
 	}
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("go.mod file not found in current directory or any parent directory")
+		}
+		dir = parent
+	}
+}
 
-	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, path, nil, mode)
+// mainpackages returns the import paths of the main packages named by the
+// given patterns, as reported by go list run in dir.  The -deps flag is not
+// used, so that only the packages matching the patterns are considered.
+func mainpackages(ctx context.Context, dir string, patterns []string) ([]string, error) {
+	args := []string{"list", "-f", `{{if eq .Name "main"}}{{.ImportPath}}{{end}}`}
+	for _, flag := range buildtags.GoFlags {
+		if flag != "-deps" {
+			args = append(args, flag)
+		}
+	}
+	args = append(args, patterns...)
+	cmd := exec.CommandContext(ctx, buildtags.GoCmd, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), buildtags.GoEnv...)
+	stdout, err := invoke.Output(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("parseheader: %v", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
 	}
 
-	return src[:f.Package-1], nil
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(stdout), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no main packages matched")
+	}
+
+	return list, nil
 }
 
-// parse adds all the build tags in the named Go file to tags.
-func parse(tags tagset, dir, name string) error {
-	// Parse the build tags defined in the Go file name.
-	autotags := parsename(name)
-	if tag := autotags[0]; tag != "" {
-		tags.add(tag)
+// relcwd returns the path relative to the current directory, or path itself
+// if it can not be made relative.
+func relcwd(path string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
 	}
-	if tag := autotags[1]; tag != "" {
-		tags.add(tag)
+	if rel, err := filepath.Rel(cwd, path); err == nil {
+		return rel, nil
 	}
 
-	// Parse the build tags in the Go file header.
-	path := filepath.Join(dir, name)
-	header, err := parseheader(path)
+	return path, nil
+}
+
+// selecttags removes from file the tags not in selected, and reports whether
+// the file contains at least one of them.
+func selecttags(file *buildtags.File, selected map[string]bool) bool {
+	tags := file.Tags[:0]
+	for _, tag := range file.Tags {
+		if selected[tag.Name] {
+			tags = append(tags, tag)
+		}
+	}
+	file.Tags = tags
+
+	return len(tags) > 0
+}
+
+// categories returns the categories specified by the -categories flag, or
+// all the categories if the flag is not set, without the ones specified by
+// the -hide flag, in the order defined by config.categories.
+func categories() ([]buildtags.Category, error) {
+	selected := make(map[buildtags.Category]bool)
+	if catflag == "" {
+		for _, c := range cfg.categories() {
+			selected[c] = true
+		}
+	} else {
+		list, err := parsecategories("categories", catflag)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range list {
+			selected[c] = true
+		}
+	}
+	hidden, err := parsecategories("hide", hideflag)
 	if err != nil {
-		return fmt.Errorf("parse %s: %v", path, err)
+		return nil, err
 	}
-	if err := parsetags(tags, header); err != nil {
-		return fmt.Errorf("parse %s: %v", path, err)
+	for _, c := range hidden {
+		delete(selected, c)
 	}
 
-	return nil
+	list := make([]buildtags.Category, 0, len(selected))
+	for _, c := range cfg.categories() {
+		if selected[c] {
+			list = append(list, c)
+		}
+	}
+
+	return list, nil
 }
 
-// parsetags adds all the build tags in the Go file header to tags.
-func parsetags(tags tagset, header []byte) error {
-	// Try to parse each line of the file header.
-	sc := bufio.NewScanner(bytes.NewReader(header))
-	for sc.Scan() {
-		line := sc.Text()
-		if !isBuildLine(line) {
+// parsecategories parses the comma separated list of categories specified by
+// the named flag.  Each category can be specified by its name or by the short
+// name, like build for build-tag, ignoring case.
+func parsecategories(flag, value string) ([]buildtags.Category, error) {
+	list := make([]buildtags.Category, 0)
+	for _, name := range split(value) {
+		name = strings.ToLower(name)
+		found := false
+		for _, c := range cfg.categories() {
+			long := strings.ToLower(string(c))
+			if name == long || name == strings.TrimSuffix(long, "-tag") {
+				list = append(list, c)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid -%s value: %q", flag, name)
+		}
+	}
+
+	return list, nil
+}
+
+// testdatapackages returns the packages in the testdata directory of each
+// package, recursively.  The returned packages inherit the module of the
+// package containing the testdata directory.
+func testdatapackages(packages []*buildtags.Package) ([]*buildtags.Package, error) {
+	list := make([]*buildtags.Package, 0)
+	for _, pkg := range packages {
+		root := filepath.Join(pkg.Dir, "testdata")
+		if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
 			continue
 		}
-		expr, err := constraint.Parse(line)
+		dirs, err := walk.Match(os.DirFS(root), "...", walk.Options{FollowSymlinks: symlinks, MaxDepth: -1})
 		if err != nil {
-			return fmt.Errorf("parsetags: %v", err)
+			return nil, err
+		}
+		for _, dir := range dirs {
+			list = append(list, &buildtags.Package{
+				Dir:        filepath.Join(root, filepath.FromSlash(dir)),
+				ImportPath: path.Join(pkg.ImportPath, "testdata", dir),
+				Module:     pkg.Module,
+			})
 		}
-		addtags(tags, expr)
-	}
-	if err := sc.Err(); err != nil {
-		return fmt.Errorf("parsetags: internal error: %v", err)
 	}
 
-	return nil
+	return list, nil
 }
 
-// addtags adds all the build tags in expr to tags.
-func addtags(tags tagset, expr constraint.Expr) {
-	switch tag := expr.(type) {
-	case *constraint.AndExpr:
-		addtags(tags, tag.X)
-		addtags(tags, tag.Y)
-	case *constraint.NotExpr:
-		addtags(tags, tag.X)
-	case *constraint.OrExpr:
-		addtags(tags, tag.X)
-		addtags(tags, tag.Y)
-	case *constraint.TagExpr:
-		tags.add(tag.Tag)
+// intestdata reports whether the package directory is in a testdata tree.
+func intestdata(dir string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(dir), "/") {
+		if elem == "testdata" {
+			return true
+		}
 	}
+
+	return false
 }
 
-func isBuildLine(line string) bool {
-	if constraint.IsGoBuild(line) || constraint.IsPlusBuild(line) {
-		return true
+// newscanner returns a new scanner, configured as specified by the
+// configuration file and the flags, with the extra options.
+func newscanner(extra ...buildtags.Option) *buildtags.Scanner {
+	opts := append(cfg.options(), buildtags.WithConcurrency(runtime.GOMAXPROCS(0)))
+	if skipgen {
+		opts = append(opts, buildtags.WithGeneratedFiles(false))
+	}
+	if symlinks {
+		opts = append(opts, buildtags.WithSymlinks(true))
+	}
+	if overlay != nil {
+		opts = append(opts, buildtags.WithOverlay(overlay))
+	}
+	if matchflag != "" {
+		opts = append(opts, buildtags.WithFilePattern(matchflag))
+	}
+	if catflag != "" || hideflag != "" {
+		list, _ := categories()
+		opts = append(opts, buildtags.WithCategories(list...))
+	}
+	switch tests {
+	case testsExclude:
+		opts = append(opts, buildtags.WithTestFiles(false))
+	case testsOnly:
+		opts = append(opts, buildtags.WithOnlyTestFiles())
 	}
+	opts = append(opts, extra...)
 
-	return false
+	return buildtags.NewScanner(opts...)
 }
 
-// golist returns a list of directories containing package sources, for the
-// packages named by the given patterns.
-func golist(patterns []string) ([]string, error) {
-	args := append([]string{"list", "-f", "{{.Dir}}"}, patterns...)
-	cmd := exec.Command(gocmd, args...)
-	stdout, err := invoke.Output(cmd)
+// overlay maps the paths of the files replaced by the -overlay file to the
+// paths of the replacement files.
+var overlay map[string]string
+
+// readoverlay reads the Replace field of the named overlay file, as defined
+// by the go command -overlay flag.
+func readoverlay(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
 	if err != nil {
 		return nil, err
 	}
+	var v struct {
+		Replace map[string]string
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("overlay %s: %v", name, err)
+	}
+	if v.Replace == nil {
+		v.Replace = make(map[string]string)
+	}
 
-	// Parse the list of package directories.
-	list := make([]string, 0)
-	sc := bufio.NewScanner(bytes.NewReader(stdout))
-	for sc.Scan() {
-		list = append(list, sc.Text())
+	return v.Replace, nil
+}
+
+// render returns the path of the named file in pkg, as specified by the -path
+// flag.
+func render(pkg *buildtags.Package, name string) string {
+	path := filepath.Join(pkg.Dir, name)
+	switch pathmode {
+	case pathAbs:
+		// Packages scanned with the -dir flag may have a relative
+		// directory.
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+
+		return path
+	case pathImport:
+		// Packages scanned with the -dir flag or read from stdin have
+		// no import path, and are rendered like with -path=rel.
+		if pkg.ImportPath != "" {
+			return pkg.ImportPath + "/" + name
+		}
 	}
-	if err := sc.Err(); err != nil {
-		return nil, fmt.Errorf("golist: internal error: %v", err)
+
+	// Packages not in a module, like the ones in the standard library, are
+	// rendered using the absolute path.
+	if pkg.Module == nil || pkg.Module.Dir == "" {
+		return path
 	}
 
-	return list, nil
+	// Vendored packages are rendered relative to the module containing
+	// the vendor directory.
+	root := pkg.Module.Dir
+	sep := string(filepath.Separator)
+	if i := strings.LastIndex(root, sep+"vendor"+sep); i >= 0 {
+		root = root[:i]
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+
+	return rel
 }
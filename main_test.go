@@ -0,0 +1,424 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// TestDedup tests the dedup function.
+func TestDedup(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirs := []string{
+		filepath.Join(root, "a"),
+		filepath.Join(root, "b"),
+		filepath.Join(root, "a", "..", "a"),
+		filepath.Join(root, "a"),
+	}
+	if err := os.Symlink("a", filepath.Join(root, "link")); err == nil {
+		dirs = append(dirs, filepath.Join(root, "link"))
+	}
+
+	packages := make([]*buildtags.Package, 0)
+	for _, dir := range dirs {
+		packages = append(packages, &buildtags.Package{Dir: dir})
+	}
+	got := make([]string, 0)
+	for _, pkg := range dedup(packages) {
+		got = append(got, pkg.Dir)
+	}
+	want := dirs[:2]
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+// TestPaginate tests the paginate function.
+func TestPaginate(t *testing.T) {
+	packages := make([]*buildtags.Package, 0)
+	for _, dir := range []string{"a", "b", "c", "d"} {
+		packages = append(packages, &buildtags.Package{Dir: dir})
+	}
+	tests := []struct {
+		offset int
+		limit  int
+		want   []string
+	}{
+		{0, 0, []string{"a", "b", "c", "d"}},
+		{1, 0, []string{"b", "c", "d"}},
+		{0, 2, []string{"a", "b"}},
+		{2, 1, []string{"c"}},
+		{3, 5, []string{"d"}},
+		{4, 0, []string{}},
+		{9, 1, []string{}},
+	}
+	for _, test := range tests {
+		got := make([]string, 0)
+		for _, pkg := range paginate(packages, test.offset, test.limit) {
+			got = append(got, pkg.Dir)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("paginate(%d, %d): want %q, got %q", test.offset, test.limit, test.want, got)
+		}
+	}
+}
+
+// newReport returns a report with a single package in dir, having the files
+// parsed from src, that maps each file name to its content.  The files are
+// sorted by name.
+func newReport(t *testing.T, dir string, src map[string]string) *buildtags.Report {
+	t.Helper()
+
+	names := make([]string, 0, len(src))
+	for name := range src {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pkg := &buildtags.Package{Dir: dir, Files: make([]*buildtags.File, 0)}
+	for _, name := range names {
+		file, err := buildtags.ParseFile(name, []byte(src[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg.Files = append(pkg.Files, file)
+	}
+
+	return &buildtags.Report{Packages: []*buildtags.Package{pkg}}
+}
+
+// TestCgofiles tests the cgofiles function.
+func TestCgofiles(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		cgo  bool   // whether the file is reported
+		expr string // reported constraint
+	}{
+		{"a.go", "package a\n\nimport \"C\"\n", true, ""},
+		{"b_linux.go", "//go:build cgo && !purego\n\npackage a\n\nimport \"C\"\n", true, "linux && cgo && !purego"},
+		{"c.go", "//go:build !cgo\n\npackage a\n", false, ""},
+	}
+	src := make(map[string]string)
+	want := make([]cgofile, 0)
+	for _, test := range tests {
+		src[test.name] = test.src
+		if test.cgo {
+			want = append(want, cgofile{File: filepath.Join("a", test.name), Expr: test.expr})
+		}
+	}
+
+	got := make([]cgofile, 0)
+	for _, f := range cgofiles(newReport(t, "a", src)) {
+		got = append(got, *f)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestPuregofiles tests the puregofiles function.
+func TestPuregofiles(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		role string // reported role, or empty if not reported
+	}{
+		{"a.go", "package a\n", ""},
+		{"a_amd64.go", "//go:build !purego\n\npackage a\n", roleImplementation},
+		{"a_amd64.s", "//go:build !purego\n", roleImplementation},
+		{"a_purego.go", "//go:build purego || !amd64\n\npackage a\n", ""},
+		{"b.go", "//go:build purego && linux\n\npackage a\n", roleFallback},
+	}
+	src := make(map[string]string)
+	want := make([]puregofile, 0)
+	for _, test := range tests {
+		src[test.name] = test.src
+		if test.role != "" {
+			want = append(want, puregofile{File: filepath.Join("a", test.name), Role: test.role})
+		}
+	}
+
+	got := make([]puregofile, 0)
+	for _, f := range puregofiles(newReport(t, "a", src)) {
+		got = append(got, *f)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestCompilerfiles tests the compilerfiles function.
+func TestCompilerfiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		compilers []string // reported compilers, or nil if not reported
+	}{
+		{"a.go", "package a\n", nil},
+		{"b_gc.go", "//go:build gc\n\npackage a\n", []string{"gc"}},
+		{"c_gccgo.go", "//go:build gccgo && linux\n\npackage a\n", []string{"gccgo"}},
+		{"d.go", "//go:build !gc\n\npackage a\n", []string{"gccgo"}},
+		{"e.go", "//go:build gc || gccgo\n\npackage a\n", nil},
+	}
+	src := make(map[string]string)
+	want := make([]compilerfile, 0)
+	for _, test := range tests {
+		src[test.name] = test.src
+		if test.compilers != nil {
+			want = append(want, compilerfile{File: filepath.Join("a", test.name), Compilers: test.compilers})
+		}
+	}
+
+	got := make([]compilerfile, 0)
+	for _, f := range compilerfiles(newReport(t, "a", src)) {
+		got = append(got, *f)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestFuzzfiles tests the fuzzfiles function.
+func TestFuzzfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		kind string // reported kind, or empty if not reported
+	}{
+		{"a.go", "package a\n", ""},
+		{"a_fuzz.go", "//go:build gofuzz\n\npackage a\n", fuzzGoFuzz},
+		{"b.go", "//go:build gofuzz || linux\n\npackage a\n", ""},
+		{"fuzz_test.go", "//go:build go1.18\n\npackage a\n", fuzzNative},
+		{"go118_test.go", "//go:build go1.18\n\npackage a\n", ""},
+		{"lib_fuzz.go", "//go:build libfuzzer && !gofuzz\n\npackage a\n", fuzzGoFuzz},
+		{"parse_fuzz.go", "//go:build go1.20\n\npackage a\n", ""},
+		{"x_fuzz_test.go", "//go:build go1.17\n\npackage a\n", ""},
+	}
+	src := make(map[string]string)
+	want := make([]fuzzfile, 0)
+	for _, test := range tests {
+		src[test.name] = test.src
+		if test.kind != "" {
+			want = append(want, fuzzfile{File: filepath.Join("a", test.name), Kind: test.kind})
+		}
+	}
+
+	got := make([]fuzzfile, 0)
+	for _, f := range fuzzfiles(newReport(t, "a", src)) {
+		got = append(got, *f)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestCollapse tests the collapse function.
+func TestCollapse(t *testing.T) {
+	report := newReport(t, "a", map[string]string{
+		"a.go":      "//go:build legacy_sql\n\npackage a\n",
+		"b.go":      "//go:build sqlite || legacy_sql\n\npackage a\n",
+		"c_test.go": "//go:build old_os\n\npackage a\n",
+	})
+	aliases := map[string]string{"legacy_sql": "sqlite", "old_os": "corp_os"}
+	overrides := map[string]buildtags.Category{"corp_os": buildtags.SpecialTag}
+	collapse(report, aliases, overrides)
+
+	type result struct {
+		Name      string
+		Category  buildtags.Category
+		Positions int
+		TestOnly  bool
+	}
+	got := make([]result, 0)
+	for _, tag := range report.Tags() {
+		got = append(got, result{tag.Name, tag.Category, len(tag.Positions), tag.TestOnly})
+	}
+	want := []result{
+		{"corp_os", buildtags.SpecialTag, 1, true},
+		{"sqlite", buildtags.BuildTag, 3, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestCgoonlyfiles tests the cgoonlyfiles function.
+func TestCgoonlyfiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		reason string // reported reason, or empty if not reported
+	}{
+		{"a.go", "package a\n", ""},
+		{"b.go", "package a\n\nimport \"C\"\n", cgoImport},
+		{"c_linux.go", "//go:build cgo\n\npackage a\n", cgoTag},
+		{"d.go", "//go:build !cgo\n\npackage a\n", ""},
+		{"e.c", "int e(void) { return 0; }\n", cgoSource},
+		{"e.h", "int e(void);\n", ""},
+		{"f.go", "//go:build cgo || purego\n\npackage a\n", ""},
+	}
+	src := make(map[string]string)
+	files := make([]*cgoonlyfile, 0)
+	for _, test := range tests {
+		src[test.name] = test.src
+		if test.reason != "" {
+			files = append(files, &cgoonlyfile{File: filepath.Join("a", test.name), Reason: test.reason})
+		}
+	}
+	report := newReport(t, "a", src)
+	report.Packages[0].ImportPath = "example.com/a"
+	empty := &buildtags.Package{Dir: "b", Files: make([]*buildtags.File, 0)}
+	report.Packages = append(report.Packages, empty)
+
+	got := cgoonlyfiles(report)
+	want := []*cgoonlypkg{{Package: "example.com/a", Files: files}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestMismatch tests the mismatch function.
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		ok   bool
+	}{
+		{"package a\n", 0, true},
+		{"//go:build linux\n\npackage a\n", 0, true},
+		{"// +build linux\n\npackage a\n", 0, true},
+		{"//go:build linux && !cgo\n// +build linux,!cgo\n\npackage a\n", 2, true},
+		{"//go:build linux && !cgo\n// +build linux\n// +build !cgo\n\npackage a\n", 2, true},
+		{"//go:build linux || darwin\n// +build linux darwin\n\npackage a\n", 2, true},
+		{"//go:build linux && !cgo\n// +build linux cgo\n\npackage a\n", 2, false},
+		{"//go:build darwin\n// +build linux\n\npackage a\n", 2, false},
+	}
+	for _, test := range tests {
+		file, err := buildtags.ParseFile("a.go", []byte(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, ok := mismatch(file)
+		if line != test.line || ok != test.ok {
+			t.Errorf("mismatch(%q): want %d, %t, got %d, %t", test.src, test.line, test.ok, line, ok)
+		}
+	}
+}
+
+// TestLegacyfiles tests the legacyfiles function.
+func TestLegacyfiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		legacy bool // whether the file is reported
+	}{
+		{"a.go", "package a\n", false},
+		{"b.go", "// +build linux\n\npackage a\n", true},
+		{"c.go", "//go:build linux\n// +build linux\n\npackage a\n", false},
+		{"d_amd64.s", "// +build !purego\n\n", true},
+		{"e_linux.go", "//go:build cgo\n\npackage a\n", false},
+	}
+	src := make(map[string]string)
+	files := make([]string, 0)
+	for _, test := range tests {
+		src[test.name] = test.src
+		if test.legacy {
+			files = append(files, filepath.Join("a", test.name))
+		}
+	}
+
+	got := legacyfiles(newReport(t, "a", src))
+	want := []*legacypkg{{Package: "a", Files: files}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// TestPrintUnknownCategory tests that the tags with a category not declared in
+// the configuration, like in a report produced with a different
+// configuration, are rendered as build tags.
+func TestPrintUnknownCategory(t *testing.T) {
+	tags := []*buildtags.Tag{
+		{
+			Name:      "wasi",
+			Category:  "tinygo",
+			Positions: []buildtags.Position{{File: "a.go", Line: 1, Origin: buildtags.GoBuild}},
+		},
+	}
+
+	var text bytes.Buffer
+	if err := printtext(&text, tags); err != nil {
+		t.Fatal(err)
+	}
+	if want := "build-tag:\n    wasi    1"; !strings.Contains(text.String(), want) {
+		t.Errorf("want text output containing %q, got %q", want, text.String())
+	}
+
+	var md bytes.Buffer
+	printtables(&md, tags)
+	if want := "## build-tag\n\n| Tag | Count | Positions |\n| --- | ---: | --- |\n| `wasi` | 1 |"; !strings.Contains(md.String(), want) {
+		t.Errorf("want Markdown output containing %q, got %q", want, md.String())
+	}
+}
+
+// TestRenderImport tests the render function with -path=import.
+func TestRenderImport(t *testing.T) {
+	defer func(mode string) { pathmode = mode }(pathmode)
+	pathmode = pathImport
+
+	tests := []struct {
+		pkg  *buildtags.Package
+		want string
+	}{
+		{&buildtags.Package{Dir: "/mod/a", ImportPath: "example.com/a"}, "example.com/a/a.go"},
+		{&buildtags.Package{Dir: "a"}, filepath.Join("a", "a.go")},
+		{&buildtags.Package{Dir: "."}, "a.go"},
+	}
+	for _, test := range tests {
+		if got := render(test.pkg, "a.go"); got != test.want {
+			t.Errorf("render(%+v): want %q, got %q", test.pkg, test.want, got)
+		}
+	}
+}
+
+// TestRedundantpos tests the redundantpos function.
+func TestRedundantpos(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+	}{
+		{"a_linux.go", "//go:build linux\n\npackage a\n", 1},
+		{"a_linux.go", "// Copyright.\n\n//go:build linux && cgo\n// +build linux,cgo\n\npackage a\n", 3},
+		{"a_linux.go", "// +build cgo\n// +build linux\n\npackage a\n", 2},
+		{"a_linux.go", "// +build linux cgo\n// +build amd64\n\npackage a\n", 1},
+	}
+	for _, test := range tests {
+		file, err := buildtags.ParseFile(test.name, []byte(test.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := buildtags.NameResidual(file); !ok {
+			t.Fatalf("NameResidual(%q): want true", test.src)
+		}
+		if pos := redundantpos(test.name, file); pos.Line != test.line {
+			t.Errorf("redundantpos(%q): want line %d, got %d", test.src, test.line, pos.Line)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var matrixCmd = &command{
+	name:  "matrix",
+	args:  "[packages]",
+	short: "compute the build configurations needed to compile every file",
+	flags: matrixFlags,
+	run:   runMatrix,
+}
+
+// matrix command flags.
+var (
+	matrixFlags = flag.NewFlagSet("matrix", flag.ExitOnError)
+)
+
+// runMatrix prints the set of GOOS, GOARCH, cgo and build tags configurations
+// needed to compile every Go file in the specified packages at least once.
+func runMatrix(ctx context.Context, args []string) error {
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	// The release tags are the ones of the host toolchain.
+	base := buildtags.DefaultContext()
+	base.CgoEnabled = false
+	base.Tags = nil
+
+	matrix, excluded := report.Matrix(base)
+	for _, m := range excluded {
+		log.Printf("%s: not included in any build configuration", render(m.Package, m.File.Name))
+	}
+
+	return printmatrix(os.Stdout, matrix)
+}
+
+// printmatrix writes the build configurations to w, using the format specified
+// by the -format flag.
+//
+// The text format uses a line for each configuration, with the environment
+// variables and the flags to pass to the go command.  The JSON format uses a
+// list of objects, suitable for a CI build matrix.
+func printmatrix(w io.Writer, matrix []buildtags.BuildContext) error {
+	if format == formatJSON {
+		type config struct {
+			GOOS        string
+			GOARCH      string
+			CGO_ENABLED string
+			Tags        string
+		}
+
+		list := make([]config, 0, len(matrix))
+		for _, ctx := range matrix {
+			list = append(list, config{
+				GOOS:        ctx.GOOS,
+				GOARCH:      ctx.GOARCH,
+				CGO_ENABLED: cgoenabled(ctx),
+				Tags:        strings.Join(ctx.Tags, ","),
+			})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(list)
+	}
+
+	for _, ctx := range matrix {
+		line := fmt.Sprintf("GOOS=%s GOARCH=%s CGO_ENABLED=%s", ctx.GOOS, ctx.GOARCH, cgoenabled(ctx))
+		if len(ctx.Tags) > 0 {
+			line += " -tags=" + strings.Join(ctx.Tags, ",")
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	return nil
+}
+
+// cgoenabled returns the value of the CGO_ENABLED environment variable for
+// ctx.
+func cgoenabled(ctx buildtags.BuildContext) string {
+	if ctx.CgoEnabled {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// Roles of the files in the purego convention.
+const (
+	roleFallback       = "fallback"       // pure Go fallback, built with purego
+	roleImplementation = "implementation" // assembly or cgo code, built without purego
+)
+
+// puregofile is a file whose constraints depend on the purego tag.
+type puregofile struct {
+	File string // file path
+	Role string // fallback or implementation
+}
+
+// puregofiles returns the files in the report providing the pure Go fallback,
+// only built with the purego tag, and the ones providing the assembly or cgo
+// implementation, only built without it.
+func puregofiles(report *buildtags.Report) []*puregofile {
+	list := make([]*puregofile, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			x := effective(file)
+			if x == nil {
+				continue
+			}
+			role := ""
+			if unsatisfiable(x, map[string]bool{"purego": true}) {
+				role = roleImplementation
+			} else if unsatisfiable(x, map[string]bool{"purego": false}) {
+				role = roleFallback
+			}
+			if role != "" {
+				list = append(list, &puregofile{File: render(pkg, file.Name), Role: role})
+			}
+		}
+	}
+
+	return list
+}
+
+// printpurego writes to w the files providing the pure Go fallback and the
+// assembly or cgo implementation.
+func printpurego(w io.Writer, files []*puregofile) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(tw, "purego:")
+	for _, f := range files {
+		fmt.Fprintf(tw, "\t%s\t%s\n", f.File, f.Role)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,269 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var renameCmd = &command{
+	name:  "rename",
+	args:  "oldtag newtag [packages] | -aliases [packages]",
+	short: "rename a build tag in the constraints of the packages",
+	flags: renameFlags,
+	run:   runRename,
+}
+
+// rename command flags.
+var (
+	renameFlags = flag.NewFlagSet("rename", flag.ExitOnError)
+	renamediff  = renameFlags.Bool("diff", false, "display diffs instead of rewriting files")
+	renamewrite = renameFlags.Bool("w", false, "write result to source file instead of listing it")
+	renamefiles = renameFlags.Bool("files", false, "also rename the files with oldtag as GOOS or GOARCH suffix")
+	renamealias = renameFlags.Bool("aliases", false, "rename all the tag aliases declared in the configuration to their canonical tags")
+)
+
+// runRename renames a build tag in all the //go:build and // +build lines of
+// the Go files in the specified packages.  With the -aliases flag, all the
+// aliases declared in the configuration are renamed instead.
+func runRename(ctx context.Context, args []string) error {
+	if *renamealias {
+		return renameAliases(ctx, args)
+	}
+	if len(args) < 2 {
+		return errors.New("rename: oldtag and newtag must be specified")
+	}
+	oldtag, newtag := args[0], args[1]
+	if !istag(oldtag) || !istag(newtag) {
+		return fmt.Errorf("rename: invalid tag name")
+	}
+	if *renamefiles && !suffixable(oldtag, newtag) {
+		return fmt.Errorf("rename: %s and %s are not both GOOS or GOARCH values", oldtag, newtag)
+	}
+
+	report, err := load(ctx, args[2:])
+	if err != nil {
+		return err
+	}
+
+	return rename(report, map[string]string{oldtag: newtag})
+}
+
+// renameAliases renames the tag aliases declared in the configuration to
+// their canonical tags, in the specified packages.
+func renameAliases(ctx context.Context, args []string) error {
+	if len(cfg.Aliases) == 0 {
+		return errors.New("rename: no aliases declared in the configuration")
+	}
+	if *renamefiles {
+		for alias, canonical := range cfg.Aliases {
+			c := buildtags.Categorize(alias)
+			if (c == buildtags.GOOS || c == buildtags.GOARCH) && !suffixable(alias, canonical) {
+				return fmt.Errorf("rename: %s and %s are not both GOOS or GOARCH values", alias, canonical)
+			}
+		}
+	}
+
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	return rename(report, cfg.Aliases)
+}
+
+// rename renames the build tags in all the files of the report, as specified
+// by the mapping from the old to the new tag names.
+func rename(report *buildtags.Report, mapping map[string]string) error {
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			path := filepath.Join(pkg.Dir, file.Name)
+			edits, err := renameedits(path, file, mapping)
+			if err != nil {
+				return err
+			}
+			if len(edits) > 0 {
+				err := apply(path, render(pkg, file.Name), edits, *renamediff, *renamewrite)
+				if err != nil {
+					return err
+				}
+			}
+			if *renamefiles {
+				if err := renamefile(pkg, file, mapping); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// renameedits returns the line edits renaming the build tags in the
+// constraint lines of the named file.
+func renameedits(path string, file *buildtags.File, mapping map[string]string) (map[int]lineedit, error) {
+	edits := make(map[int]lineedit)
+	if !hastag(file, mapping) {
+		return edits, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitlines(src)
+	for _, c := range file.Constraints {
+		line := lines[c.Line-1]
+		if newline := renametags(line, mapping); newline != line {
+			edits[c.Line] = lineedit{insert: newline, delete: true}
+		}
+	}
+
+	return edits, nil
+}
+
+// hastag reports whether a build constraint in file uses one of the tags in
+// mapping.
+func hastag(file *buildtags.File, mapping map[string]string) bool {
+	for _, tag := range file.Tags {
+		if _, ok := mapping[tag.Name]; !ok {
+			continue
+		}
+		for _, pos := range tag.Positions {
+			if pos.Origin != buildtags.FileName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// renametags renames the build tags in a constraint line, preserving the
+// formatting.
+func renametags(line string, mapping map[string]string) string {
+	// Skip the //go:build or // +build prefix.
+	i := strings.Index(line, "build")
+	if i < 0 {
+		return line
+	}
+	i += len("build")
+
+	b := new(strings.Builder)
+	b.WriteString(line[:i])
+	for i < len(line) {
+		j := i
+		for j < len(line) && istagchar(line[j]) {
+			j++
+		}
+		if j == i {
+			b.WriteByte(line[i])
+			i++
+
+			continue
+		}
+
+		tag := line[i:j]
+		if newtag, ok := mapping[tag]; ok {
+			tag = newtag
+		}
+		b.WriteString(tag)
+		i = j
+	}
+
+	return b.String()
+}
+
+// renamefile renames file, if its name has a GOOS or GOARCH suffix in
+// mapping.  An existing file is never overwritten.
+func renamefile(pkg *buildtags.Package, file *buildtags.File, mapping map[string]string) error {
+	name := renamesuffix(file.Name, mapping)
+	if name == file.Name {
+		return nil
+	}
+
+	oldpath := filepath.Join(pkg.Dir, file.Name)
+	newpath := filepath.Join(pkg.Dir, name)
+	if _, err := os.Lstat(newpath); err == nil {
+		return fmt.Errorf("rename: %s: %s already exists", render(pkg, file.Name), render(pkg, name))
+	}
+	if !*renamewrite {
+		fmt.Printf("%s -> %s\n", render(pkg, file.Name), render(pkg, name))
+
+		return nil
+	}
+
+	return os.Rename(oldpath, newpath)
+}
+
+// renamesuffix returns the file name with the GOOS and GOARCH values in mapping
+// renamed.  Only the _goos, _goarch or _goos_goarch suffix before the optional
+// _test suffix and the extension is changed, as in foo_linux_test.go.
+func renamesuffix(name string, mapping map[string]string) string {
+	stem, ext := name, ""
+	if dot := strings.Index(name, "."); dot >= 0 {
+		stem, ext = name[:dot], name[dot:]
+	}
+	test := ""
+	if strings.HasSuffix(stem, "_test") {
+		stem, test = strings.TrimSuffix(stem, "_test"), "_test"
+	}
+
+	goos, goarch := buildtags.ParseFileName(name)
+	oldsuffix, newsuffix := "", ""
+	for _, tag := range []string{goos, goarch} {
+		if tag == "" {
+			continue
+		}
+		oldsuffix += "_" + tag
+		if newtag, ok := mapping[tag]; ok {
+			tag = newtag
+		}
+		newsuffix += "_" + tag
+	}
+	if oldsuffix == newsuffix || !strings.HasSuffix(stem, oldsuffix) {
+		return name
+	}
+	stem = strings.TrimSuffix(stem, oldsuffix) + newsuffix
+
+	return stem + test + ext
+}
+
+// suffixable reports whether both the tags can be used as a file name suffix,
+// being both GOOS or GOARCH values.
+func suffixable(oldtag, newtag string) bool {
+	c1, c2 := buildtags.Categorize(oldtag), buildtags.Categorize(newtag)
+
+	return c1 == c2 && (c1 == buildtags.GOOS || c1 == buildtags.GOARCH)
+}
+
+// istag reports whether s is a valid build tag name.
+func istag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !istagchar(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// istagchar reports whether c is a valid character in a build tag name, as
+// defined by the go/build/constraint package.
+func istagchar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '.'
+}
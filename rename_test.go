@@ -0,0 +1,83 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var renametagsTests = []struct {
+	line string
+	want string
+}{
+	{"//go:build foo\n", "//go:build bar\n"},
+	{"//go:build (foo || linux) && !foo\n", "//go:build (bar || linux) && !bar\n"},
+	{"//go:build foobar && xfoo\n", "//go:build foobar && xfoo\n"},
+	{"// +build foo,linux !foo\n", "// +build bar,linux !bar\n"},
+	{"// +build build\n", "// +build build\n"},
+}
+
+// TestRenametags tests the renametags function.
+func TestRenametags(t *testing.T) {
+	mapping := map[string]string{"foo": "bar"}
+	for _, test := range renametagsTests {
+		got := renametags(test.line, mapping)
+		if got != test.want {
+			t.Errorf("renametags(%q): want %q, got %q", test.line, test.want, got)
+		}
+	}
+}
+
+var renamesuffixTests = []struct {
+	name string
+	want string
+}{
+	{"foo_linux.go", "foo_windows.go"},
+	{"foo_linux_test.go", "foo_windows_test.go"},
+	{"foo_linux_amd64.s", "foo_windows_arm64.s"},
+	{"foo_amd64.go", "foo_arm64.go"},
+	{"linux_foo_linux.go", "linux_foo_windows.go"},
+	{"foo_linux_bar.go", "foo_linux_bar.go"},
+	{"foo_linux.pb.go", "foo_windows.pb.go"},
+	{"foo_darwin.go", "foo_darwin.go"},
+	{"foo.go", "foo.go"},
+}
+
+// TestRenamesuffix tests the renamesuffix function.
+func TestRenamesuffix(t *testing.T) {
+	mapping := map[string]string{"linux": "windows", "amd64": "arm64"}
+	for _, test := range renamesuffixTests {
+		got := renamesuffix(test.name, mapping)
+		if got != test.want {
+			t.Errorf("renamesuffix(%q): want %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+// TestRenamefileExists tests that the renamefile function does not overwrite
+// an existing file.
+func TestRenamefileExists(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"foo_linux.go", "foo_windows.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("package foo\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(write bool) { *renamewrite = write }(*renamewrite)
+	*renamewrite = true
+
+	pkg := &buildtags.Package{Dir: dir}
+	file := &buildtags.File{Name: "foo_linux.go"}
+	if err := renamefile(pkg, file, map[string]string{"linux": "windows"}); err == nil {
+		t.Error("expected err != nil")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foo_linux.go")); err != nil {
+		t.Errorf("want foo_linux.go not renamed: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var renderCmd = &command{
+	name:  "render",
+	args:  "",
+	short: "render a JSON report produced by list in another format",
+	flags: renderFlags,
+	run:   runRender,
+}
+
+// render command flags.
+var (
+	renderFlags = flag.NewFlagSet("render", flag.ExitOnError)
+	renderinput = renderFlags.String("i", "-", "read the JSON report from `file`; - means stdin")
+)
+
+// runRender reads a report produced by list -format=json and prints it in the
+// output format, without scanning the packages again.
+func runRender(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("render: unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	var r io.Reader = os.Stdin
+	if name := *renderinput; name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var in struct {
+		Packages     []*buildtags.Package
+		TestdataTags []*buildtags.Tag
+	}
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return fmt.Errorf("render: invalid report: %v", err)
+	}
+	report := &buildtags.Report{Packages: in.Packages}
+
+	// The report has been produced with the -include-testdata flag.
+	includetestdata = includetestdata || len(in.TestdataTags) > 0
+
+	switch format {
+	case formatJSON:
+		return printjson(os.Stdout, report)
+	case formatMarkdown:
+		return printmarkdown(os.Stdout, report)
+	}
+
+	return printreport(os.Stdout, report)
+}
+
+// printmarkdown writes to w the tags in the report grouped by category, as
+// Markdown tables, the ignored, header and excluded files and the tags in the
+// testdata directories.
+func printmarkdown(w io.Writer, report *buildtags.Report) error {
+	code, testdata := splittestdata(report)
+
+	fmt.Fprintln(w, "# Build tags")
+	printtables(w, sources(code).Tags())
+
+	fmt.Fprintf(w, "\n## ignored-file\n\n")
+	ignored := ignoredfiles(report)
+	if len(ignored) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range ignored {
+		fmt.Fprintf(w, "- `%s`: %s\n", f.File, strings.Join(f.Tags, ", "))
+	}
+
+	fmt.Fprintf(w, "\n## other-file\n\n")
+	other := otherfiles(report)
+	if len(other) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range other {
+		fmt.Fprintf(w, "- `%s`: %s\n", f.File, strings.Join(f.Tags, ", "))
+	}
+
+	fmt.Fprintf(w, "\n## standalone-file\n\n")
+	standalone := standalonefiles(report)
+	if len(standalone) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, name := range standalone {
+		fmt.Fprintf(w, "- `%s`\n", name)
+	}
+
+	fmt.Fprintf(w, "\n## cgo-file\n\n")
+	cgo := cgofiles(report)
+	if len(cgo) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range cgo {
+		line := "- `" + f.File + "`"
+		if f.Expr != "" {
+			line += ": `" + f.Expr + "`"
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	fmt.Fprintf(w, "\n## cgo-only\n\n")
+	cgoonly := cgoonlyfiles(report)
+	if len(cgoonly) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, p := range cgoonly {
+		fmt.Fprintf(w, "- `%s`: %d files\n", p.Package, len(p.Files))
+		for _, f := range p.Files {
+			fmt.Fprintf(w, "  - `%s`: %s\n", f.File, f.Reason)
+		}
+	}
+
+	fmt.Fprintf(w, "\n## compiler-file\n\n")
+	compiler := compilerfiles(report)
+	if len(compiler) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range compiler {
+		fmt.Fprintf(w, "- `%s`: %s\n", f.File, strings.Join(f.Compilers, ", "))
+	}
+
+	fmt.Fprintf(w, "\n## fuzz-file\n\n")
+	fuzz := fuzzfiles(report)
+	if len(fuzz) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range fuzz {
+		fmt.Fprintf(w, "- `%s`: %s\n", f.File, f.Kind)
+	}
+
+	fmt.Fprintf(w, "\n## legacy-only\n\n")
+	legacy := legacyfiles(report)
+	if len(legacy) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, p := range legacy {
+		fmt.Fprintf(w, "- `%s`: %d files\n", p.Package, len(p.Files))
+		for _, name := range p.Files {
+			fmt.Fprintf(w, "  - `%s`\n", name)
+		}
+	}
+
+	fmt.Fprintf(w, "\n## excluded-file\n\n")
+	excluded := excludedfiles(report)
+	if len(excluded) == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+	for _, f := range excluded {
+		line := "- `" + f.File + "`"
+		if f.Expr != "" {
+			line += ": `" + f.Expr + "`"
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	if len(testdata.Packages) > 0 {
+		fmt.Fprintf(w, "\n# Build tags in testdata\n")
+		printtables(w, sources(testdata).Tags())
+	}
+
+	return nil
+}
+
+// printtables writes to w a Markdown table for each category of tags.
+func printtables(w io.Writer, tags []*buildtags.Tag) {
+	selected, _ := categories()
+	for _, c := range selected {
+		fmt.Fprintf(w, "\n## %s\n\n", c)
+
+		n := 0
+		for _, tag := range tags {
+			if cfg.known(tag.Category) != c {
+				continue
+			}
+			if n == 0 {
+				fmt.Fprintln(w, "| Tag | Count | Positions |")
+				fmt.Fprintln(w, "| --- | ---: | --- |")
+			}
+			n++
+
+			locs := make([]string, 0, len(tag.Positions))
+			for _, pos := range tag.Positions {
+				loc := pos.File
+				if pos.Line > 0 {
+					loc += ":" + strconv.Itoa(pos.Line)
+				}
+				locs = append(locs, "`"+loc+"`")
+			}
+			name := "`" + tag.Name + "`"
+			if tag.TestOnly {
+				name += " (test only)"
+			}
+			if c == buildtags.GOOS || c == buildtags.GOARCH {
+				name += " (" + portclass(tag.Name) + ")"
+			}
+			if d := cfg.description(tag.Name); d != "" {
+				name += ": " + d
+			}
+			fmt.Fprintf(w, "| %s | %d | %s |\n", name, len(tag.Positions), strings.Join(locs, ", "))
+		}
+		if n == 0 {
+			fmt.Fprintln(w, "None.")
+		}
+	}
+}
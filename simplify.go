@@ -0,0 +1,87 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var simplifyCmd = &command{
+	name:  "simplify",
+	args:  "[packages]",
+	short: "suggest simpler equivalents of the build constraints in the packages",
+	flags: simplifyFlags,
+	run:   runSimplify,
+}
+
+// simplify command flags.
+var simplifyFlags = flag.NewFlagSet("simplify", flag.ExitOnError)
+
+// suggestion is a simpler equivalent of a build constraint.
+type suggestion struct {
+	File   string // file path
+	Line   int    // line of the constraint
+	Before string // constraint expression
+	After  string // simpler equivalent expression
+}
+
+// runSimplify prints a simpler equivalent of each build constraint in the
+// specified packages that can be simplified.
+func runSimplify(ctx context.Context, args []string) error {
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	return printsuggestions(os.Stdout, suggestions(report))
+}
+
+// suggestions returns a simpler equivalent of each //go:build and // +build
+// constraint in the report that can be simplified.
+func suggestions(report *buildtags.Report) []*suggestion {
+	list := make([]*suggestion, 0)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			for _, c := range file.Constraints {
+				before := c.Expr.String()
+				after := buildtags.Simplify(c.Expr).String()
+				if after == before {
+					continue
+				}
+				list = append(list, &suggestion{
+					File:   render(pkg, file.Name),
+					Line:   c.Line,
+					Before: before,
+					After:  after,
+				})
+			}
+		}
+	}
+
+	return list
+}
+
+// printsuggestions writes the suggestions to w, using the output format.
+func printsuggestions(w io.Writer, list []*suggestion) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(list)
+	}
+	for _, s := range list {
+		fmt.Fprintf(w, "%s:%s: %s\n\t=> %s\n", s.File, strconv.Itoa(s.Line), s.Before, s.After)
+	}
+
+	return nil
+}
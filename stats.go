@@ -0,0 +1,127 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var statsCmd = &command{
+	name:  "stats",
+	args:  "[packages]",
+	short: "show aggregate build tag metrics for the packages",
+	flags: statsFlags,
+	run:   runStats,
+}
+
+// stats command flags.
+var (
+	statsFlags = flag.NewFlagSet("stats", flag.ExitOnError)
+	statstop   = statsFlags.Int("n", 10, "show the `n` most used custom tags and deepest expressions")
+)
+
+// runStats prints the aggregate build tag metrics for the specified packages.
+func runStats(ctx context.Context, args []string) error {
+	report, err := load(ctx, args)
+	if err != nil {
+		return err
+	}
+	stats := report.Stats(*statstop)
+	if n := *statstop; n >= 0 && len(stats.CustomTags) > n {
+		stats.CustomTags = stats.CustomTags[:n]
+	}
+
+	return printstats(os.Stdout, stats)
+}
+
+// printstats writes the stats to w, using the output format.
+func printstats(w io.Writer, stats *buildtags.Stats) error {
+	type depth struct {
+		File  string
+		Line  int
+		Expr  string
+		Depth int
+	}
+
+	deepest := make([]depth, 0, len(stats.Deepest))
+	for _, d := range stats.Deepest {
+		deepest = append(deepest, depth{
+			File:  render(d.Package, d.File.Name),
+			Line:  d.Constraint.Line,
+			Expr:  d.Constraint.Expr.String(),
+			Depth: d.Depth,
+		})
+	}
+
+	if format == formatJSON {
+		out := struct {
+			Packages       int
+			Files          int
+			Constrained    int
+			Unconstrained  int
+			TagsPerPackage map[int]int
+			CustomTags     []*buildtags.TagCount
+			Deepest        []depth
+		}{
+			Packages:       stats.Packages,
+			Files:          stats.Files,
+			Constrained:    stats.Constrained,
+			Unconstrained:  stats.Unconstrained,
+			TagsPerPackage: stats.TagsPerPackage,
+			CustomTags:     stats.CustomTags,
+			Deepest:        deepest,
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(out)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(tw, "packages:\t%d\n", stats.Packages)
+	fmt.Fprintf(tw, "files:\t%d\n", stats.Files)
+	fmt.Fprintf(tw, "constrained:\t%d\t%s\n", stats.Constrained, percent(stats.Constrained, stats.Files))
+	fmt.Fprintf(tw, "unconstrained:\t%d\t%s\n", stats.Unconstrained, percent(stats.Unconstrained, stats.Files))
+
+	fmt.Fprintf(tw, "tags per package:\n")
+	counts := make([]int, 0, len(stats.TagsPerPackage))
+	for n := range stats.TagsPerPackage {
+		counts = append(counts, n)
+	}
+	sort.Ints(counts)
+	for _, n := range counts {
+		fmt.Fprintf(tw, "\t%d\t%d\n", n, stats.TagsPerPackage[n])
+	}
+
+	fmt.Fprintf(tw, "custom tags:\n")
+	for _, tag := range stats.CustomTags {
+		fmt.Fprintf(tw, "\t%s\t%d\n", tag.Name, tag.Files)
+	}
+
+	fmt.Fprintf(tw, "deepest expressions:\n")
+	for _, d := range deepest {
+		fmt.Fprintf(tw, "\t%s:%d\t%d\t%s\n", d.File, d.Line, d.Depth, d.Expr)
+	}
+
+	return tw.Flush()
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
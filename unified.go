@@ -0,0 +1,182 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ncontext is the number of context lines in a unified diff hunk.
+const ncontext = 3
+
+// edit is a line in an edit script.
+type edit struct {
+	op   byte   // ' ' for an unchanged line, '-' for a deleted line, '+' for an inserted line
+	line string // line content, including the newline
+}
+
+// unified returns the unified diff between the old and current content of the
+// named file.  It returns nil if old and cur are equal.
+//
+// Since go-buildtags only changes a few lines in the file headers, the common
+// prefix and suffix are removed before computing the longest common
+// subsequence of the remaining lines.
+func unified(name string, old, cur []byte) []byte {
+	if bytes.Equal(old, cur) {
+		return nil
+	}
+	edits := diff(splitlines(old), splitlines(cur))
+
+	// Compute the old and new line numbers at the start of each edit.
+	aline := make([]int, len(edits)+1)
+	bline := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aline[i+1], bline[i+1] = aline[i], bline[i]
+		if e.op != '+' {
+			aline[i+1]++
+		}
+		if e.op != '-' {
+			bline[i+1]++
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s.orig\n+++ %s\n", name, name)
+	for i, n := 0, len(edits); i < n; {
+		// Find the next change.
+		for i < n && edits[i].op == ' ' {
+			i++
+		}
+		if i == n {
+			break
+		}
+
+		// Extend the hunk while the changes are near.
+		start := i - ncontext
+		if start < 0 {
+			start = 0
+		}
+		last := i
+		for j := i; j < n && j-last <= 2*ncontext; j++ {
+			if edits[j].op != ' ' {
+				last = j
+			}
+		}
+		end := last + ncontext + 1
+		if end > n {
+			end = n
+		}
+
+		acount := aline[end] - aline[start]
+		bcount := bline[end] - bline[start]
+		astart, bstart := aline[start]+1, bline[start]+1
+		if acount == 0 {
+			astart--
+		}
+		if bcount == 0 {
+			bstart--
+		}
+		fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", astart, acount, bstart, bcount)
+		for _, e := range edits[start:end] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.line)
+			if len(e.line) == 0 || e.line[len(e.line)-1] != '\n' {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+
+	return buf.Bytes()
+}
+
+// diff returns an edit script transforming a into b.
+func diff(a, b []string) []edit {
+	// Remove the common prefix and suffix.
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a[:p] {
+		edits = append(edits, edit{' ', line})
+	}
+	edits = append(edits, lcs(a[p:len(a)-s], b[p:len(b)-s])...)
+	for _, line := range a[len(a)-s:] {
+		edits = append(edits, edit{' ', line})
+	}
+
+	return edits
+}
+
+// lcs returns an edit script transforming a into b, using the longest common
+// subsequence algorithm.
+func lcs(a, b []string) []edit {
+	n, m := len(a), len(b)
+	table := make([][]int, n+1)
+	for i := range table {
+		table[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				table[i][j] = table[i+1][j+1] + 1
+			case table[i+1][j] >= table[i][j+1]:
+				table[i][j] = table[i+1][j]
+			default:
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+
+	edits := make([]edit, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+
+	return edits
+}
+
+// splitlines splits data into lines, including the newline.
+func splitlines(data []byte) []string {
+	list := make([]string, 0)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			list = append(list, string(data))
+
+			break
+		}
+		list = append(list, string(data[:i+1]))
+		data = data[i+1:]
+	}
+
+	return list
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+// TestUnified tests the unified function.
+func TestUnified(t *testing.T) {
+	const old = "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	const cur = "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	const want = `--- x.go.orig
++++ x.go
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+`
+	if got := string(unified("x.go", []byte(old), []byte(cur))); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if got := unified("x.go", []byte(old), []byte(old)); got != nil {
+		t.Errorf("want nil, got:\n%s", got)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+// vendored returns the packages in the vendor directory of each of the module
+// root directories, as listed in the vendor/modules.txt file.  Each package
+// is attributed to the module it has been vendored from.  Roots without a
+// vendor directory are ignored.
+func vendored(roots []string) ([]*buildtags.Package, error) {
+	packages := make([]*buildtags.Package, 0)
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		vendor := filepath.Join(abs, "vendor")
+		data, err := os.ReadFile(filepath.Join(vendor, "modules.txt"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		packages = append(packages, parsemodules(vendor, data)...)
+	}
+
+	return packages, nil
+}
+
+// parsemodules returns the packages listed in the content of the
+// vendor/modules.txt file, in the specified vendor directory.
+func parsemodules(vendor string, data []byte) []*buildtags.Package {
+	packages := make([]*buildtags.Package, 0)
+
+	var mod *buildtags.Module
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "## "):
+			// Annotations, like "## explicit".
+		case strings.HasPrefix(line, "# "):
+			// A module line, like "# path version [=> replacement]".
+			fields := strings.Fields(line[2:])
+			mod = &buildtags.Module{
+				Path: fields[0],
+				Dir:  filepath.Join(vendor, filepath.FromSlash(fields[0])),
+			}
+			if len(fields) > 1 && fields[1] != "=>" {
+				mod.Version = fields[1]
+			}
+		case mod != nil:
+			packages = append(packages, &buildtags.Package{
+				Dir:        filepath.Join(vendor, filepath.FromSlash(line)),
+				ImportPath: line,
+				Module:     mod,
+			})
+		}
+	}
+
+	return packages
+}
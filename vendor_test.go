@@ -0,0 +1,41 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestParsemodules tests the parsemodules function.
+func TestParsemodules(t *testing.T) {
+	const data = `# golang.org/x/sys v0.1.0
+## explicit; go 1.17
+golang.org/x/sys/unix
+golang.org/x/sys/windows
+# example.com/local v1.0.0 => ../local
+example.com/local/pkg
+# example.com/replaced => example.com/fork v1.1.0
+`
+	vendor := filepath.FromSlash("/mod/vendor")
+	packages := parsemodules(vendor, []byte(data))
+	if n := len(packages); n != 3 {
+		t.Fatalf("want 3 packages, got %d", n)
+	}
+
+	pkg := packages[1]
+	if pkg.ImportPath != "golang.org/x/sys/windows" {
+		t.Errorf("want ImportPath = golang.org/x/sys/windows, got %s", pkg.ImportPath)
+	}
+	if want := filepath.FromSlash("/mod/vendor/golang.org/x/sys/windows"); pkg.Dir != want {
+		t.Errorf("want Dir = %s, got %s", want, pkg.Dir)
+	}
+	if m := pkg.Module; m.Path != "golang.org/x/sys" || m.Version != "v0.1.0" {
+		t.Errorf("want Module = golang.org/x/sys v0.1.0, got %s %s", m.Path, m.Version)
+	}
+	if m := packages[2].Module; m.Path != "example.com/local" || m.Version != "v1.0.0" {
+		t.Errorf("want Module = example.com/local v1.0.0, got %s %s", m.Path, m.Version)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/perillo/go-buildtags/buildtags"
+)
+
+var whyCmd = &command{
+	name:  "why",
+	args:  "files",
+	short: "explain why files are included or excluded in a build context",
+	flags: whyFlags,
+	run:   runWhy,
+}
+
+// why command flags.
+var (
+	whyFlags = flag.NewFlagSet("why", flag.ExitOnError)
+	whyCtx   = newContextFlags(whyFlags)
+)
+
+// explanation is the explanation for a file.
+type explanation struct {
+	File string
+	*buildtags.Explanation
+}
+
+// runWhy explains why each of the specified Go files is included or excluded
+// when building with the build context specified by the command flags.
+func runWhy(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("why: no files specified")
+	}
+
+	bctx := whyCtx.context()
+	list := make([]*explanation, 0, len(args))
+	for _, path := range args {
+		pkg, file, err := loadfile(ctx, path)
+		if err != nil {
+			return err
+		}
+		list = append(list, &explanation{
+			File:        render(pkg, file.Name),
+			Explanation: bctx.Explain(file),
+		})
+	}
+
+	return printwhy(os.Stdout, bctx, list)
+}
+
+// loadfile loads the package containing the named Go file and returns the
+// package and the scanned file.
+func loadfile(ctx context.Context, path string) (*buildtags.Package, *buildtags.File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := load(ctx, []string{filepath.Dir(abs)})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := filepath.Base(abs)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			if file.Name == name {
+				return pkg, file, nil
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("why: %s: not a Go file in a package", path)
+}
+
+// printwhy writes the explanations to w, using the format specified by the
+// -format flag.
+func printwhy(w io.Writer, bctx buildtags.BuildContext, list []*explanation) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(list)
+	}
+
+	for _, e := range list {
+		status := "excluded"
+		if e.Included {
+			status = "included"
+		}
+		fmt.Fprintf(w, "%s is %s with GOOS=%s GOARCH=%s\n", e.File, status, bctx.GOOS, bctx.GOARCH)
+		for _, reason := range e.Reasons {
+			fmt.Fprintln(w, "\t"+reason)
+		}
+	}
+
+	return nil
+}
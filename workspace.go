@@ -0,0 +1,103 @@
+// Copyright 2021 Manlio Perillo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/perillo/go-buildtags/buildtags"
+	"github.com/perillo/go-buildtags/internal/invoke"
+)
+
+// errNoWorkspace is returned by workmodules when no go.work file is found.
+var errNoWorkspace = errors.New("go.work file not found in current directory or any parent directory")
+
+// workmodules returns the modules of the workspace containing the current
+// directory, as defined by the go.work file and reported by go list -m.
+func workmodules(ctx context.Context) ([]*buildtags.Module, error) {
+	cmd := exec.CommandContext(ctx, buildtags.GoCmd, "env", "GOWORK")
+	stdout, err := invoke.Output(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if gowork := string(stdout); gowork == "" || gowork == "off" {
+		return nil, errNoWorkspace
+	}
+
+	cmd = exec.CommandContext(ctx, buildtags.GoCmd, "list", "-m", "-json")
+	stdout, err = invoke.Output(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the stream of JSON objects.
+	list := make([]*buildtags.Module, 0)
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	for dec.More() {
+		mod := new(buildtags.Module)
+		if err := dec.Decode(mod); err != nil {
+			return nil, fmt.Errorf("workspace: internal error: %v", err)
+		}
+		list = append(list, mod)
+	}
+
+	return list, nil
+}
+
+// workpatterns returns the patterns matching all the packages of the
+// workspace modules.  With the -dir flag, the patterns are relative to the
+// current directory, when possible.
+func workpatterns(modules []*buildtags.Module) ([]string, error) {
+	patterns := make([]string, 0, len(modules))
+	for _, mod := range modules {
+		root := mod.Dir
+		if dirmode {
+			rel, err := relcwd(root)
+			if err != nil {
+				return nil, err
+			}
+			root = rel
+		}
+		patterns = append(patterns, filepath.Join(root, "..."))
+	}
+
+	return patterns, nil
+}
+
+// attribute sets the module of the packages scanned with the -dir flag to
+// the workspace module containing the package directory.  The module
+// directory is not set, so that the files are still rendered relative to the
+// current directory.
+func attribute(packages []*buildtags.Package, modules []*buildtags.Module) error {
+	for _, pkg := range packages {
+		dir, err := filepath.Abs(pkg.Dir)
+		if err != nil {
+			return err
+		}
+		// Workspace modules can be nested, so the innermost module
+		// is used.
+		var found *buildtags.Module
+		for _, mod := range modules {
+			if dir != mod.Dir && !strings.HasPrefix(dir, mod.Dir+string(filepath.Separator)) {
+				continue
+			}
+			if found == nil || len(mod.Dir) > len(found.Dir) {
+				found = mod
+			}
+		}
+		if found != nil {
+			pkg.Module = &buildtags.Module{Path: found.Path}
+		}
+	}
+
+	return nil
+}